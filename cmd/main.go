@@ -1,6 +1,10 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"github/heimaolst/collectionbox/internal/biz"
 	"github/heimaolst/collectionbox/internal/data"
 	"github/heimaolst/collectionbox/internal/logx"
@@ -10,35 +14,111 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+const (
+	originConfigPath = "resource/origin.json"
+	// originCacheTTL bounds how long origin changes made by another instance
+	// sharing the database take to show up here
+	originCacheTTL = 30 * time.Second
+)
+
 func main() {
 	// init logger first so subsequent steps log consistently
 	logx.Init()
 
-	db, err := gorm.Open(sqlite.Open("col.db"), &gorm.Config{Logger: logx.NewGormLogger()})
-	if err != nil {
-		slog.Error("db connection failed", "err", err)
+	storage := flag.String("storage", "sql", "where collections live: sql (DB_DSN, default sqlite://col.db) or memory (lost on exit)")
+	autoMigrate := flag.Bool("auto-migrate", false, "apply pending schema migrations on startup instead of refusing to start")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags]\n       %s migrate [up | down | to N | status]\n       %s reclassify [-dry-run] [-after ID] [-batch N]\n", os.Args[0], os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(context.Background(), openDB(), flag.Args()[1:]); err != nil {
+			slog.Error("migrate failed", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.Arg(0) == "reclassify" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err := runReclassify(ctx, openDB(), flag.Args()[1:])
+		stop()
+		if err != nil {
+			slog.Error("reclassify failed", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var (
+		collectionRepo    biz.CollectionRepo
+		originRepo        biz.OriginRepo
+		shortLinkResolver data.ShortLinkResolver
+	)
+	switch *storage {
+	case "sql":
+		db := openDB()
+		if err := checkSchema(context.Background(), db, *autoMigrate); err != nil {
+			slog.Error("database schema check failed", "err", err)
+			os.Exit(1)
+		}
+		collectionRepo = data.NewSQLRepo(db)
+		originRepo = data.NewSQLOriginRepo(db)
+		shortLinkResolver = data.NewShortLinkResolver(db, 5, 5*time.Second)
+	case "memory":
+		slog.Warn("using in-memory storage; collections are lost on exit")
+		collectionRepo = data.NewMemoryRepo()
+		originRepo = data.NewMemoryOriginRepo()
+		shortLinkResolver = data.NewShortLinkResolver(nil, 5, 5*time.Second)
+	default:
+		slog.Error("unknown storage, want sql or memory", "storage", *storage)
 		os.Exit(1)
 	}
-	collectionRepo := data.NewSQLRepo(db)
-	originExtractor, err := data.NewJSONOriginExtractor("resource/origin.json")
+	originExtractor, err := newOriginExtractor(context.Background(), originRepo, data.WithShortLinkResolver(shortLinkResolver))
 	if err != nil {
 		slog.Error("failed to load origin config", "err", err)
 		os.Exit(1)
 	}
 	// L3: Biz
 	collectionUsecase := biz.NewCollectionUsecase(collectionRepo, originExtractor)
+	originUsecase := biz.NewOriginUsecase(originRepo, originExtractor)
+
+	// background jobs stop when ctx is cancelled on shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go collectionUsecase.RunTrashPurger(ctx, time.Hour, trashRetention())
+
+	// origins are re-read on SIGHUP and, unless disabled, when origin.json changes
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				_ = originExtractor.Reload(ctx)
+			}
+		}
+	}()
+	if interval := originWatchInterval(); interval > 0 {
+		go originExtractor.Watch(ctx, interval)
+	}
 
 	// L2: Service
 	collectionService := service.NewService(collectionUsecase)
+	originService := service.NewOriginService(originUsecase)
 
 	// L1: Server
-	srv := server.NewHTTPServer(":8080", collectionService)
+	srv := server.NewHTTPServer(":8080", collectionService, originService)
 	go func() {
 		slog.Info("server starting", "addr", ":8080")
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -50,7 +130,75 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	slog.Info("shutdown signal received")
+	cancel()
 	// optional: graceful shutdown
 	// simple shutdown (no active connections drain). For future: srv.Shutdown(ctx).
 	_ = srv.Close()
 }
+
+// newOriginExtractor serves extraction from the origins in repo. Origins live
+// in the database; origin.json seeds the items it hasn't seeded yet and keeps
+// the settings shared by all origins.
+func newOriginExtractor(ctx context.Context, repo biz.OriginRepo, opts ...data.ExtractorOption) (*data.ReloadingOriginExtractor, error) {
+	if _, err := data.SeedOrigins(ctx, repo, originConfigPath); err != nil {
+		return nil, fmt.Errorf("seed origins: %w", err)
+	}
+	return data.NewDBOriginExtractor(ctx, originConfigPath, repo, originCacheTTL, opts...)
+}
+
+// checkSchema makes sure the schema is the one this binary was built for.
+// Startup only reads the version: pending migrations are applied by
+// `migrate up`, or here when autoMigrate is set, and a schema written by a
+// newer release is refused either way.
+func checkSchema(ctx context.Context, db *gorm.DB, autoMigrate bool) error {
+	if autoMigrate {
+		return data.MigrateUp(ctx, db)
+	}
+	err := data.CheckSchema(ctx, db)
+	if errors.Is(err, data.ErrSchemaPending) {
+		return fmt.Errorf("%w; run `%s migrate up` first, or start with -auto-migrate", err, os.Args[0])
+	}
+	return err
+}
+
+// openDB connects to DB_DSN (default sqlite://col.db) or exits.
+func openDB() *gorm.DB {
+	dsn := os.Getenv("DB_DSN")
+	if dsn == "" {
+		dsn = "sqlite://col.db"
+	}
+	db, err := data.Open(dsn, &gorm.Config{Logger: logx.NewGormLogger()})
+	if err != nil {
+		slog.Error("db connection failed", "err", err)
+		os.Exit(1)
+	}
+	return db
+}
+
+// trashRetention reads TRASH_RETENTION_DAYS (default 30): how long deleted
+// collections stay in the trash before they are purged for good.
+func trashRetention() time.Duration {
+	days := 30
+	if v := os.Getenv("TRASH_RETENTION_DAYS"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed >= 0 {
+			days = parsed
+		} else {
+			slog.Warn("invalid TRASH_RETENTION_DAYS, using default", "value", v, "default", days)
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// originWatchInterval reads ORIGIN_WATCH_INTERVAL (default 5s): how often
+// origin.json is checked for changes. 0 turns watching off, leaving SIGHUP.
+func originWatchInterval() time.Duration {
+	interval := 5 * time.Second
+	if v := os.Getenv("ORIGIN_WATCH_INTERVAL"); v != "" {
+		if parsed, err := time.ParseDuration(v); err == nil && parsed >= 0 {
+			interval = parsed
+		} else {
+			slog.Warn("invalid ORIGIN_WATCH_INTERVAL, using default", "value", v, "default", interval)
+		}
+	}
+	return interval
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github/heimaolst/collectionbox/internal/data"
+
+	"gorm.io/gorm"
+)
+
+// runMigrate implements the migrate subcommand:
+//
+//	migrate [up]    apply every pending migration
+//	migrate down    roll back the latest applied migration
+//	migrate to N    move up or down to version N (0 drops everything)
+//	migrate status  print the current and latest versions
+func runMigrate(ctx context.Context, db *gorm.DB, args []string) error {
+	cmd := "up"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+	switch cmd {
+	case "up":
+		return data.MigrateUp(ctx, db)
+	case "down":
+		current, err := data.SchemaVersion(ctx, db)
+		if err != nil {
+			return err
+		}
+		if current == 0 {
+			return errors.New("nothing to roll back")
+		}
+		return data.MigrateTo(ctx, db, current-1)
+	case "to":
+		if len(args) != 1 {
+			return errors.New("usage: migrate to N")
+		}
+		target, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("version must be a number: %w", err)
+		}
+		return data.MigrateTo(ctx, db, target)
+	case "status":
+		current, err := data.SchemaVersion(ctx, db)
+		if err != nil {
+			return err
+		}
+		latest := data.LatestSchemaVersion()
+		state := "up to date"
+		switch {
+		case current < latest:
+			state = fmt.Sprintf("%d pending", latest-current)
+		case current > latest:
+			state = "newer than this binary"
+		}
+		fmt.Printf("schema version %d, latest %d (%s)\n", current, latest, state)
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q (want up, down, to N or status)", cmd)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github/heimaolst/collectionbox/internal/biz"
+	"github/heimaolst/collectionbox/internal/data"
+
+	"gorm.io/gorm"
+)
+
+// runReclassify implements the reclassify subcommand:
+//
+//	reclassify [-dry-run] [-after ID] [-batch N]
+//
+// It moves every collection to the origin the current rules give it, one
+// batch per transaction. Interrupting it abandons the batch in progress and
+// prints the -after that resumes the run.
+func runReclassify(ctx context.Context, db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("reclassify", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would change without writing anything")
+	after := fs.String("after", "", "resume an interrupted run after this collection ID")
+	batch := fs.Int("batch", 200, "collections read and updated per transaction")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkSchema(ctx, db, false); err != nil {
+		return err
+	}
+	extractor, err := newOriginExtractor(ctx, data.NewSQLOriginRepo(db))
+	if err != nil {
+		return err
+	}
+	uc := biz.NewCollectionUsecase(data.NewSQLRepo(db), extractor)
+	report, err := uc.Reclassify(ctx, biz.ReclassifyOptions{DryRun: *dryRun, After: *after, BatchSize: *batch})
+	if report != nil {
+		printReclassifyReport(report)
+	}
+	if err != nil {
+		if report != nil && report.Next != "" {
+			fmt.Printf("stopped early; resume with: reclassify -after %s\n", report.Next)
+		}
+		return err
+	}
+	return nil
+}
+
+func printReclassifyReport(r *biz.ReclassifyReport) {
+	verb := "moved"
+	if r.DryRun {
+		verb = "would move"
+	}
+	fmt.Printf("scanned %d collections: %s %d, %d not matched by any rule\n", r.Scanned, verb, r.Changed, r.Unmatched)
+	if r.Skipped > 0 {
+		fmt.Printf("skipped %d edited while the run was under way\n", r.Skipped)
+	}
+	for _, m := range r.Moves {
+		fmt.Printf("  %s -> %s: %d\n", m.From, m.To, m.Count)
+	}
+	if r.DryRun {
+		for _, c := range r.Changes {
+			fmt.Printf("  %s %s: %s -> %s\n", c.ID, c.URL, c.From, c.To)
+		}
+		if r.Changed > len(r.Changes) {
+			fmt.Printf("  ... and %d more\n", r.Changed-len(r.Changes))
+		}
+	}
+}
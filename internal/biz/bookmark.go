@@ -0,0 +1,179 @@
+package biz
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Bookmark is one link read from a browser export. Folders is the folder
+// path from the root, outermost first.
+type Bookmark struct {
+	URL     string
+	Title   string
+	AddDate time.Time
+	Folders []string
+}
+
+// ImportStatus is the outcome of importing one bookmark.
+type ImportStatus string
+
+const (
+	ImportImported  ImportStatus = "imported"
+	ImportDuplicate ImportStatus = "duplicate"
+	// ImportTrashed means the link is in the trash; restore it to keep it.
+	ImportTrashed     ImportStatus = "trashed"
+	ImportUnsupported ImportStatus = "unsupported"
+	ImportFailed      ImportStatus = "failed"
+)
+
+// ImportItem reports what happened to a single bookmark.
+type ImportItem struct {
+	URL          string       `json:"url"`
+	Status       ImportStatus `json:"status"`
+	Origin       string       `json:"origin,omitempty"`
+	CollectionID string       `json:"collection_id,omitempty"`
+	Reason       string       `json:"reason,omitempty"`
+}
+
+// ImportReport summarizes an import; Items follow the input order.
+type ImportReport struct {
+	Imported    int
+	Duplicates  int
+	Trashed     int
+	Unsupported int
+	Failed      int
+	Items       []ImportItem
+}
+
+func (r *ImportReport) add(item ImportItem) {
+	switch item.Status {
+	case ImportImported:
+		r.Imported++
+	case ImportDuplicate:
+		r.Duplicates++
+	case ImportTrashed:
+		r.Trashed++
+	case ImportUnsupported:
+		r.Unsupported++
+	case ImportFailed:
+		r.Failed++
+	}
+	r.Items = append(r.Items, item)
+}
+
+// ImportBookmarks runs every bookmark through the origin extractor and saves
+// the supported ones, using the folder path as tags and AddDate as CreatedAt.
+// Folder names that aren't valid tags are skipped and listed in the item's
+// Reason.
+// Links that already exist are reported as duplicates, or as trashed when
+// they sit in the trash, and left untouched.
+// Imported links are logged as saves attributed to src.
+func (uc *CollectionUsecase) ImportBookmarks(ctx context.Context, bookmarks []Bookmark, src SaveSource) (*ImportReport, error) {
+	if uc == nil || uc.repo == nil || uc.originex == nil {
+		return nil, ErrInvalidArgument.WithMessage("repository or origin extractor not configured")
+	}
+	report := &ImportReport{Items: make([]ImportItem, 0, len(bookmarks))}
+	for _, bm := range bookmarks {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.add(uc.importBookmark(ctx, bm, src))
+	}
+	return report, nil
+}
+
+func (uc *CollectionUsecase) importBookmark(ctx context.Context, bm Bookmark, src SaveSource) ImportItem {
+	item := ImportItem{URL: bm.URL}
+	pairs, err := uc.originex.ExtractAll(ctx, bm.URL)
+	if err != nil || len(pairs) == 0 {
+		item.Status = ImportUnsupported
+		if err != nil {
+			item.Reason = err.Error()
+		}
+		return item
+	}
+	// a bookmark holds exactly one link; ignore anything else the extractor found
+	p := pairs[0]
+	item.Origin = p.Origin
+
+	fail := func(err error) ImportItem {
+		item.Status, item.Reason = ImportFailed, err.Error()
+		return item
+	}
+
+	existing, err := uc.findExisting(ctx, p)
+	if err != nil {
+		return fail(err)
+	}
+	if existing != nil {
+		item.Status, item.CollectionID = ImportDuplicate, existing.ID
+		if existing.DeletedAt != nil {
+			item.Status, item.Reason = ImportTrashed, "in the trash; restore it to keep it"
+		}
+		return item
+	}
+
+	createdAt := bm.AddDate
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	title := bm.Title
+	if title == "" {
+		title = p.Title
+	}
+	// a folder that can't be a tag is skipped; the others still apply
+	var tags, skipped []string
+	for _, folder := range bm.Folders {
+		t, err := NormalizeTags([]string{folder})
+		if err != nil {
+			skipped = append(skipped, folder)
+			continue
+		}
+		tags = append(tags, t...)
+	}
+	slices.Sort(tags)
+	tags = slices.Compact(tags)
+	// the row and its tags are written in one transaction
+	saved, err := uc.repo.UpsertCollection(ctx, &Collection{
+		ID:          uuid.NewString(),
+		URL:         p.CanonicalURL,
+		RawURL:      bm.URL,
+		Origin:      p.Origin,
+		ContentType: p.ContentType,
+		ContentID:   p.ContentID,
+		Title:       title,
+		Tags:        tags,
+		Status:      StatusUnread,
+		CreatedAt:   createdAt,
+	}, src.event(bm.URL))
+	if err != nil {
+		return fail(err)
+	}
+	item.Status, item.CollectionID = ImportImported, saved.ID
+	if len(skipped) > 0 {
+		item.Reason = "folders not used as tags: " + strings.Join(skipped, ", ")
+	}
+	return item
+}
+
+// findExisting looks the pair up by content id, then by canonical URL,
+// which also finds a trashed row: saving over it would silently restore it.
+// It returns nil when the link is new.
+func (uc *CollectionUsecase) findExisting(ctx context.Context, p URLOriPair) (*Collection, error) {
+	if p.ContentID != "" {
+		col, err := uc.repo.GetByContentID(ctx, p.Origin, p.ContentType, p.ContentID)
+		if err == nil || !errors.Is(err, ErrNotFound) {
+			return col, err
+		}
+	}
+	col, err := uc.repo.GetByURL(ctx, p.CanonicalURL)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	return col, err
+}
@@ -6,16 +6,121 @@ import (
 )
 
 type Collection struct {
-	ID        string
-	CreatedAt time.Time
-	URL       string
-	Origin    string
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// URL is the canonical URL and uniquely identifies a collection.
+	URL string `json:"url"`
+	// RawURL is the most recently saved link before canonicalization.
+	RawURL string `json:"raw_url"`
+	Origin string `json:"origin"`
+	// ContentType and ContentID identify the underlying item so that
+	// different links to the same video/question/product collapse together.
+	ContentType string `json:"content_type"`
+	ContentID   string `json:"content_id"`
+	Title       string `json:"title"`
+	// Note is free text the user attached to the collection.
+	Note   string   `json:"note"`
+	Tags   []string `json:"tags"`
+	Status Status   `json:"status"`
+	// ReadAt is when the collection was last marked done; nil otherwise.
+	ReadAt *time.Time `json:"read_at"`
+	// DeletedAt is set while the collection sits in the trash.
+	DeletedAt *time.Time `json:"deleted_at"`
+	// SaveCount is how many times the link was saved; LastSavedAt is when it
+	// was saved most recently, which differs from CreatedAt for imports.
+	SaveCount   int64      `json:"save_count"`
+	LastSavedAt *time.Time `json:"last_saved_at"`
+}
+
+// UpsertResult is the outcome of saving one collection.
+type UpsertResult struct {
+	Collection *Collection
+	// Created is false when the URL was already saved, in the trash or not.
+	Created bool
+}
+
+// CollectionFilter selects collections for bulk operations such as export.
+// Zero fields do not restrict anything.
+type CollectionFilter struct {
+	Origin string
+	Start  *time.Time
+	End    *time.Time
+	Tags   TagFilter
+}
+
+// CollectionPatch lists the user-editable fields of a Collection.
+// Nil fields are left unchanged.
+type CollectionPatch struct {
+	Title  *string
+	Origin *string
+	Note   *string
 }
 
 type CollectionRepo interface {
-	UpsertCollection(ctx context.Context, collection *Collection) (*Collection, error)
+	// UpsertCollection saves collection and records event for it in the same
+	// transaction, bumping SaveCount and LastSavedAt.
+	UpsertCollection(ctx context.Context, collection *Collection, event CollectionEvent) (*Collection, error)
+	// UpsertMany saves collections, whose URLs must be distinct, in a single
+	// transaction, recording event for each. Results follow the input order.
+	// Nothing is written when it fails. Tags, already normalized, are added
+	// to the ones a collection has.
+	UpsertMany(ctx context.Context, collections []*Collection, event CollectionEvent) ([]*UpsertResult, error)
 	UpdateCollection(ctx context.Context, collection *Collection) error
-	GetByTimeRange(ctx context.Context, start time.Time, end time.Time, origin string) ([]*Collection, error)
-	GetByOrigin(ctx context.Context, origin string) ([]*Collection, error)
-	GetAllGroupedByOrigin(context.Context) (map[string][]*Collection, error)
+	// GetByTimeRange and GetByOrigin page newest-first by (CreatedAt, ID).
+	GetByTimeRange(ctx context.Context, start time.Time, end time.Time, origin string, tags TagFilter, page PageRequest) (*Page, error)
+	GetByOrigin(ctx context.Context, origin string, tags TagFilter, page PageRequest) (*Page, error)
+	// GetByURL looks up a canonical URL, trashed rows included (DeletedAt
+	// tells them apart); it returns ErrNotFound when absent.
+	GetByURL(ctx context.Context, url string) (*Collection, error)
+	// GetByContentID returns ErrNotFound when no collection matches.
+	GetByContentID(ctx context.Context, origin, contentType, contentID string) (*Collection, error)
+	// GetAllGroupedByOrigin returns at most perOrigin newest collections per origin.
+	GetAllGroupedByOrigin(ctx context.Context, tags TagFilter, perOrigin int) (map[string]*Page, error)
+	// GetByID, Update and Delete return ErrNotFound when id does not exist.
+	GetByID(ctx context.Context, id string) (*Collection, error)
+	Update(ctx context.Context, collection *Collection) error
+	// Delete moves a collection to the trash.
+	Delete(ctx context.Context, id string) error
+	ListTrash(ctx context.Context) ([]*Collection, error)
+	// Restore returns ErrNotFound when id is not in the trash.
+	Restore(ctx context.Context, id string) error
+	// PurgeTrash permanently removes collections trashed before the cutoff,
+	// along with their events.
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
+	// ListEvents returns the saves of a live collection, newest first, or
+	// ErrNotFound when id does not exist.
+	ListEvents(ctx context.Context, id string) ([]*CollectionEvent, error)
+
+	// UpdateStatus sets the read status; it returns ErrNotFound when id does
+	// not exist.
+	UpdateStatus(ctx context.Context, id string, status Status, readAt *time.Time) error
+	// GetQueue pages unread collections oldest-first; origin "" means all.
+	GetQueue(ctx context.Context, origin string, page PageRequest) (*Page, error)
+
+	// GetLatest returns the limit newest live collections matching filter.
+	GetLatest(ctx context.Context, filter CollectionFilter, limit int) ([]*Collection, error)
+	// Stream calls fn for every live collection matching filter, ordered by
+	// origin and then newest first, without holding the whole result in memory.
+	// It stops at the first error returned by fn.
+	Stream(ctx context.Context, filter CollectionFilter, fn func(*Collection) error) error
+
+	// Search returns up to limit collections matching q, best first.
+	Search(ctx context.Context, q SearchQuery, limit int) ([]*SearchResult, error)
+
+	// AddTags and RemoveTag return ErrNotFound when the collection (or, for
+	// RemoveTag, the tag) does not exist.
+	AddTags(ctx context.Context, id string, tags []string) error
+	RemoveTag(ctx context.Context, id string, tag string) error
+	ListTags(ctx context.Context) ([]*TagCount, error)
+	// ListOrigins counts live collections per origin, busiest first.
+	ListOrigins(ctx context.Context) ([]*OriginCount, error)
+
+	// ListAfter returns up to limit collections, trashed ones included, whose
+	// ID sorts after the given one, in ID order; "" starts at the beginning.
+	ListAfter(ctx context.Context, after string, limit int) ([]*Collection, error)
+	// SetOrigins applies changes in a single transaction, moving each
+	// collection from From to To only while its origin is still From, so an
+	// edit made since it was read wins. It returns the changes applied; the
+	// others, and IDs that don't exist, are skipped.
+	SetOrigins(ctx context.Context, changes []*OriginChange) ([]*OriginChange, error)
 }
@@ -6,8 +6,9 @@ import (
 	"strings"
 	"time"
 
+	"github/heimaolst/collectionbox/internal/logx"
+
 	"github.com/google/uuid"
-	"github.com/mattn/go-sqlite3"
 )
 
 type CollectionUsecase struct {
@@ -20,33 +21,89 @@ func NewCollectionUsecase(repo CollectionRepo, ex OriginExtractor) *CollectionUs
 }
 
 // CreateCollectionsFromText extracts all URL:Origin pairs from the input text
-// and persists each as a Collection. Returns all successfully duplications Collections.
-func (uc *CollectionUsecase) UpsertCollectionsFromText(ctx context.Context, text string) ([]*Collection, error) {
+// and persists them as Collections in one go: either every link is saved or
+// none is. Each result says whether its link was new; the report explains
+// what happened to every candidate link, including the ones not saved.
+// Every save is logged as a CollectionEvent attributed to src.
+func (uc *CollectionUsecase) UpsertCollectionsFromText(ctx context.Context, text string, src SaveSource) ([]*UpsertResult, *ExtractReport, error) {
+	cols, report, err := uc.prepare(ctx, text)
+	if err != nil {
+		return nil, report, err
+	}
+	if len(cols) == 0 {
+		return nil, report, ErrInvalidArgument.WithMessage("no *supported* origin found in input text")
+	}
+	results, err := uc.repo.UpsertMany(ctx, cols, src.event(text))
+	return results, report, err
+}
+
+// ExtractFromText is a dry run of UpsertCollectionsFromText: it reports what
+// would be saved without writing anything.
+func (uc *CollectionUsecase) ExtractFromText(ctx context.Context, text string) (*ExtractReport, error) {
+	_, report, err := uc.prepare(ctx, text)
+	return report, err
+}
+
+// prepare builds the collections a save of text would write. Candidates that
+// collapse onto an earlier one are marked as duplicates in the report.
+func (uc *CollectionUsecase) prepare(ctx context.Context, text string) ([]*Collection, *ExtractReport, error) {
 	if strings.TrimSpace(text) == "" {
-		return nil, ErrInvalidArgument.WithMessage("url cannot be empty")
+		return nil, nil, ErrInvalidArgument.WithMessage("url cannot be empty")
 	}
 	if uc == nil || uc.repo == nil || uc.originex == nil {
-		return nil, ErrInvalidArgument.WithMessage("repository or origin extractor not configured")
+		return nil, nil, ErrInvalidArgument.WithMessage("repository or origin extractor not configured")
 	}
-	pairs, err := uc.originex.ExtractAll(ctx, text)
+	report, err := uc.originex.Extract(ctx, text)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	results := make([]*Collection, 0, len(pairs))
-	for _, p := range pairs {
+	var cols []*Collection
+	seen := make(map[string]bool)
+	// contentURL maps an origin/content_type/content_id key to the URL its
+	// first link in text was saved under
+	contentURL := make(map[string]string)
+	for _, c := range report.Candidates {
+		if c.Status != ExtractAccepted {
+			continue
+		}
+		p := c.Pair
 		col := &Collection{
-			ID:        uuid.NewString(),
-			URL:       p.URL,
-			Origin:    p.Origin,
-			CreatedAt: time.Now(),
+			ID:          uuid.NewString(),
+			URL:         p.CanonicalURL,
+			RawURL:      p.URL,
+			Origin:      p.Origin,
+			ContentType: p.ContentType,
+			ContentID:   p.ContentID,
+			Title:       p.Title,
+			Status:      StatusUnread,
+			CreatedAt:   time.Now(),
 		}
-		savedCol, err := uc.repo.UpsertCollection(ctx, col)
-		if err != nil {
-			return nil, err
+		// 同一内容（如手机端与桌面端的同一视频）复用已有记录的 URL，让 upsert 命中同一行
+		// 同一段文字里的也算，否则一次粘贴两端链接会存成两行
+		if p.ContentID != "" {
+			key := p.Origin + "\x00" + p.ContentType + "\x00" + p.ContentID
+			if url, ok := contentURL[key]; ok {
+				col.URL = url
+			} else {
+				existing, err := uc.repo.GetByContentID(ctx, p.Origin, p.ContentType, p.ContentID)
+				switch {
+				case err == nil:
+					col.URL = existing.URL
+				case !errors.Is(err, ErrNotFound):
+					return nil, report, err
+				}
+				contentURL[key] = col.URL
+			}
+		}
+		// 同一段文字里重复的链接只保存一次
+		if seen[col.URL] {
+			c.Reject(RejectDuplicate, "same item as an earlier link")
+			continue
 		}
-		results = append(results, savedCol)
+		seen[col.URL] = true
+		cols = append(cols, col)
 	}
-	return results, nil
+	return cols, report, nil
 }
 
 func (uc *CollectionUsecase) UpdateCollectionCreateTime(ctx context.Context, dups []string) error {
@@ -62,7 +119,7 @@ func (uc *CollectionUsecase) UpdateCollectionCreateTime(ctx context.Context, dup
 	return nil
 }
 
-func (uc *CollectionUsecase) GetByTimeRange(ctx context.Context, start, end time.Time, origin string) ([]*Collection, error) {
+func (uc *CollectionUsecase) GetByTimeRange(ctx context.Context, start, end time.Time, origin string, tags TagFilter, page PageRequest) (*Page, error) {
 	// if days <= 0 || days >= 15 {
 	// 	return nil, ErrInvalidArgument.WithMessage("too long ago")
 	// }
@@ -78,38 +135,236 @@ func (uc *CollectionUsecase) GetByTimeRange(ctx context.Context, start, end time
 	if end.Sub(start) > 15*24*time.Hour {
 		return nil, ErrInvalidArgument.WithMessage("time range can't be longer than 15 days")
 	}
-	cols, err := uc.repo.GetByTimeRange(ctx, start, end, origin)
-	if err != nil {
+	var err error
+	if tags.Tags, err = NormalizeTags(tags.Tags); err != nil {
 		return nil, err
 	}
-	return cols, nil
+	if page, err = page.normalize(); err != nil {
+		return nil, err
+	}
+	return uc.repo.GetByTimeRange(ctx, start, end, origin, tags, page)
 }
 
-func (uc *CollectionUsecase) GetByOrigin(ctx context.Context, origin string) ([]*Collection, error) {
+func (uc *CollectionUsecase) GetByOrigin(ctx context.Context, origin string, tags TagFilter, page PageRequest) (*Page, error) {
 	if origin == "" {
 		return nil, ErrInvalidArgument.WithMessage("the origin you want to search can't be empty")
 	}
-	cols, err := uc.repo.GetByOrigin(ctx, origin)
+	var err error
+	if tags.Tags, err = NormalizeTags(tags.Tags); err != nil {
+		return nil, err
+	}
+	if page, err = page.normalize(); err != nil {
+		return nil, err
+	}
+	return uc.repo.GetByOrigin(ctx, origin, tags, page)
+}
+
+// GetAllGroupedByOrigin returns the newest perOrigin collections of every
+// origin. Each group's NextCursor continues that origin via GetByOrigin.
+func (uc *CollectionUsecase) GetAllGroupedByOrigin(ctx context.Context, tags TagFilter, perOrigin int) (map[string]*Page, error) {
+	var err error
+	if tags.Tags, err = NormalizeTags(tags.Tags); err != nil {
+		return nil, err
+	}
+	if perOrigin, err = normalizePerOrigin(perOrigin); err != nil {
+		return nil, err
+	}
+	return uc.repo.GetAllGroupedByOrigin(ctx, tags, perOrigin)
+}
+
+func (uc *CollectionUsecase) GetByID(ctx context.Context, id string) (*Collection, error) {
+	if id == "" {
+		return nil, ErrInvalidArgument.WithMessage("id can't be empty")
+	}
+	return uc.repo.GetByID(ctx, id)
+}
+
+// PatchCollection applies the non-nil fields of patch and returns the updated collection.
+func (uc *CollectionUsecase) PatchCollection(ctx context.Context, id string, patch CollectionPatch) (*Collection, error) {
+	col, err := uc.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-	return cols, err
+	if patch.Title != nil {
+		col.Title = strings.TrimSpace(*patch.Title)
+	}
+	if patch.Note != nil {
+		col.Note = strings.TrimSpace(*patch.Note)
+	}
+	if patch.Origin != nil {
+		origin := strings.TrimSpace(*patch.Origin)
+		if origin == "" {
+			return nil, ErrInvalidArgument.WithMessage("origin can't be empty")
+		}
+		col.Origin = origin
+	}
+	if err := uc.repo.Update(ctx, col); err != nil {
+		return nil, err
+	}
+	return col, nil
+}
+
+func (uc *CollectionUsecase) DeleteCollection(ctx context.Context, id string) error {
+	if id == "" {
+		return ErrInvalidArgument.WithMessage("id can't be empty")
+	}
+	return uc.repo.Delete(ctx, id)
 }
 
-func (uc *CollectionUsecase) GetAllGroupedByOrigin(ctx context.Context) (map[string][]*Collection, error) {
-	maps, err := uc.repo.GetAllGroupedByOrigin(ctx)
+// UpdateStatus moves a collection to status after checking the transition is
+// allowed. Reaching done stamps ReadAt; going back to unread clears it.
+func (uc *CollectionUsecase) UpdateStatus(ctx context.Context, id string, status Status) (*Collection, error) {
+	if !status.Valid() {
+		return nil, ErrInvalidArgument.WithMessage("unknown status: " + string(status))
+	}
+	col, err := uc.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-	return maps, err
+	if !col.Status.CanTransitionTo(status) {
+		return nil, ErrInvalidArgument.WithMessage("can't move from " + string(col.Status) + " to " + string(status))
+	}
+	if col.Status == status {
+		return col, nil
+	}
+
+	readAt := col.ReadAt
+	switch status {
+	case StatusDone:
+		now := time.Now()
+		readAt = &now
+	case StatusUnread:
+		readAt = nil
+	}
+	if err := uc.repo.UpdateStatus(ctx, id, status, readAt); err != nil {
+		return nil, err
+	}
+	col.Status, col.ReadAt = status, readAt
+	return col, nil
 }
-func isSQLiteUniqueConstraintError(err error) bool {
-	var sqliteErr sqlite3.Error
-	// 使用 errors.As 沿着错误链查找底层的 sqlite3.Error
-	if errors.As(err, &sqliteErr) {
-		// SQLite 约束错误的代码通常是 SQLITE_CONSTRAINT (Code 19)
-		// ErrConstraint 是更通用的约束错误，但通常包含了唯一键冲突
-		return sqliteErr.Code == sqlite3.ErrConstraint
+
+// GetQueue returns the to-read queue: unread collections, oldest first.
+func (uc *CollectionUsecase) GetQueue(ctx context.Context, origin string, page PageRequest) (*Page, error) {
+	page, err := page.normalize()
+	if err != nil {
+		return nil, err
 	}
-	return false
+	return uc.repo.GetQueue(ctx, origin, page)
+}
+
+// feedSize is how many entries a feed carries.
+const feedSize = 50
+
+// Feed returns the newest collections matching filter, for Atom feeds.
+func (uc *CollectionUsecase) Feed(ctx context.Context, filter CollectionFilter) ([]*Collection, error) {
+	var err error
+	if filter.Tags.Tags, err = NormalizeTags(filter.Tags.Tags); err != nil {
+		return nil, err
+	}
+	return uc.repo.GetLatest(ctx, filter, feedSize)
+}
+
+// Export streams every collection matching filter to fn; see CollectionRepo.Stream.
+func (uc *CollectionUsecase) Export(ctx context.Context, filter CollectionFilter, fn func(*Collection) error) error {
+	if filter.Start != nil && filter.End != nil && !filter.End.After(*filter.Start) {
+		return ErrInvalidArgument.WithMessage("start time can't be after end time")
+	}
+	var err error
+	if filter.Tags.Tags, err = NormalizeTags(filter.Tags.Tags); err != nil {
+		return err
+	}
+	return uc.repo.Stream(ctx, filter, fn)
+}
+
+// Search runs a full-text query; see ParseSearchQuery for the syntax.
+func (uc *CollectionUsecase) Search(ctx context.Context, q string, limit int) ([]*SearchResult, error) {
+	sq, err := ParseSearchQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	page, err := PageRequest{Limit: limit}.normalize()
+	if err != nil {
+		return nil, err
+	}
+	return uc.repo.Search(ctx, sq, page.Limit)
+}
+
+func (uc *CollectionUsecase) ListTrash(ctx context.Context) ([]*Collection, error) {
+	return uc.repo.ListTrash(ctx)
+}
+
+// RestoreCollection moves a collection out of the trash and returns it.
+func (uc *CollectionUsecase) RestoreCollection(ctx context.Context, id string) (*Collection, error) {
+	if id == "" {
+		return nil, ErrInvalidArgument.WithMessage("id can't be empty")
+	}
+	if err := uc.repo.Restore(ctx, id); err != nil {
+		return nil, err
+	}
+	return uc.repo.GetByID(ctx, id)
+}
+
+// PurgeTrash permanently deletes collections that have been in the trash
+// longer than retention.
+func (uc *CollectionUsecase) PurgeTrash(ctx context.Context, retention time.Duration) (int64, error) {
+	if retention < 0 {
+		return 0, ErrInvalidArgument.WithMessage("retention can't be negative")
+	}
+	return uc.repo.PurgeTrash(ctx, time.Now().Add(-retention))
+}
+
+// RunTrashPurger calls PurgeTrash every interval until ctx is cancelled.
+func (uc *CollectionUsecase) RunTrashPurger(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := uc.PurgeTrash(ctx, retention)
+		if err != nil {
+			logx.FromContext(ctx).Error("purge trash failed", "err", err)
+		} else if n > 0 {
+			logx.FromContext(ctx).Info("trash purged", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// AddTags attaches tags to a collection and returns the updated collection.
+func (uc *CollectionUsecase) AddTags(ctx context.Context, id string, tags []string) (*Collection, error) {
+	if id == "" {
+		return nil, ErrInvalidArgument.WithMessage("id can't be empty")
+	}
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, ErrInvalidArgument.WithMessage("tags can't be empty")
+	}
+	if err := uc.repo.AddTags(ctx, id, tags); err != nil {
+		return nil, err
+	}
+	return uc.repo.GetByID(ctx, id)
+}
+
+// RemoveTag detaches one tag from a collection and returns the updated collection.
+func (uc *CollectionUsecase) RemoveTag(ctx context.Context, id, tag string) (*Collection, error) {
+	if id == "" {
+		return nil, ErrInvalidArgument.WithMessage("id can't be empty")
+	}
+	tags, err := NormalizeTags([]string{tag})
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.repo.RemoveTag(ctx, id, tags[0]); err != nil {
+		return nil, err
+	}
+	return uc.repo.GetByID(ctx, id)
+}
+
+func (uc *CollectionUsecase) ListTags(ctx context.Context) ([]*TagCount, error) {
+	return uc.repo.ListTags(ctx)
 }
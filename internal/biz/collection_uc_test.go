@@ -0,0 +1,317 @@
+package biz_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/biz"
+	"github/heimaolst/collectionbox/internal/data"
+)
+
+// stubExtractor returns fixed pairs whatever the text.
+type stubExtractor []biz.URLOriPair
+
+func (s stubExtractor) ExtractAll(context.Context, string) ([]biz.URLOriPair, error) {
+	return s, nil
+}
+
+func (s stubExtractor) KnownOrigin(origin string) bool {
+	return slices.ContainsFunc(s, func(p biz.URLOriPair) bool { return p.Origin == origin })
+}
+
+func (s stubExtractor) Extract(context.Context, string) (*biz.ExtractReport, error) {
+	report := &biz.ExtractReport{}
+	for _, p := range s {
+		report.Candidates = append(report.Candidates, &biz.ExtractCandidate{
+			Text: p.URL, Status: biz.ExtractAccepted, Key: p.CanonicalURL, Origin: p.Origin, Pair: &p,
+		})
+	}
+	return report, nil
+}
+
+func TestUpsertReusesContentID(t *testing.T) {
+	ctx := context.Background()
+	repo := data.NewMemoryRepo()
+	desktop := biz.URLOriPair{URL: "https://www.bilibili.com/video/BV1", CanonicalURL: "https://bilibili.com/video/BV1",
+		Origin: "Bilibili", ContentType: "video", ContentID: "BV1", Title: "first"}
+	mobile := biz.URLOriPair{URL: "https://m.bilibili.com/video/BV1", CanonicalURL: "https://m.bilibili.com/video/BV1",
+		Origin: "Bilibili", ContentType: "video", ContentID: "BV1"}
+
+	first, _, err := biz.NewCollectionUsecase(repo, stubExtractor{desktop}).UpsertCollectionsFromText(ctx, "x", biz.SaveSource{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := biz.NewCollectionUsecase(repo, stubExtractor{mobile}).UpsertCollectionsFromText(ctx, "x", biz.SaveSource{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first[0].Created || second[0].Created {
+		t.Errorf("Created = %v then %v, want true then false", first[0].Created, second[0].Created)
+	}
+	got, want := second[0].Collection, first[0].Collection
+	if got.ID != want.ID || got.URL != desktop.CanonicalURL || got.Title != "first" {
+		t.Errorf("mobile re-save = %+v, want the desktop collection %s", got, want.ID)
+	}
+	if got.RawURL != mobile.URL {
+		t.Errorf("RawURL = %s, want the latest link %s", got.RawURL, mobile.URL)
+	}
+}
+
+func TestUpsertReusesContentIDWithinPaste(t *testing.T) {
+	ctx := context.Background()
+	repo := data.NewMemoryRepo()
+	desktop := biz.URLOriPair{URL: "https://www.bilibili.com/video/BV1", CanonicalURL: "https://bilibili.com/video/BV1",
+		Origin: "Bilibili", ContentType: "video", ContentID: "BV1"}
+	mobile := biz.URLOriPair{URL: "https://m.bilibili.com/video/BV1", CanonicalURL: "https://m.bilibili.com/video/BV1",
+		Origin: "Bilibili", ContentType: "video", ContentID: "BV1"}
+
+	results, report, err := biz.NewCollectionUsecase(repo, stubExtractor{desktop, mobile}).UpsertCollectionsFromText(ctx, "x", biz.SaveSource{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Collection.URL != desktop.CanonicalURL || !results[0].Created {
+		t.Fatalf("results = %+v, want one new collection at %s", results, desktop.CanonicalURL)
+	}
+	if c := report.Candidates[1]; c.Status != biz.ExtractRejected || c.Reason != biz.RejectDuplicate {
+		t.Errorf("mobile link reported as %s/%s, want rejected/duplicate", c.Status, c.Reason)
+	}
+	p, err := repo.GetByOrigin(ctx, "Bilibili", biz.TagFilter{}, biz.PageRequest{Limit: 10})
+	if err != nil || len(p.Items) != 1 {
+		t.Errorf("stored %d collections (%v), want 1", len(p.Items), err)
+	}
+}
+
+func TestUpsertCollapsesRepeatedLinks(t *testing.T) {
+	ctx := context.Background()
+	a := biz.URLOriPair{URL: "https://a/1?utm_source=x", CanonicalURL: "https://a/1", Origin: "A"}
+	b := biz.URLOriPair{URL: "https://a/2", CanonicalURL: "https://a/2", Origin: "A"}
+	uc := biz.NewCollectionUsecase(data.NewMemoryRepo(), stubExtractor{a, b, {URL: "https://a/1", CanonicalURL: "https://a/1", Origin: "A"}})
+	results, report, err := uc.UpsertCollectionsFromText(ctx, "x", biz.SaveSource{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := report.Candidates[2]; c.Status != biz.ExtractRejected || c.Reason != biz.RejectDuplicate {
+		t.Errorf("repeated link reported as %s/%s, want rejected/duplicate", c.Status, c.Reason)
+	}
+	if len(results) != 2 || results[0].Collection.URL != a.CanonicalURL || results[1].Collection.URL != b.CanonicalURL {
+		t.Fatalf("results = %+v, want one per distinct link", results)
+	}
+	if !results[0].Created || !results[1].Created {
+		t.Errorf("Created = %v, %v; want both new", results[0].Created, results[1].Created)
+	}
+}
+
+func TestUpdateStatus(t *testing.T) {
+	ctx := context.Background()
+	uc := biz.NewCollectionUsecase(data.NewMemoryRepo(), stubExtractor{{URL: "https://a/1", CanonicalURL: "https://a/1", Origin: "A"}})
+	cols, _, err := uc.UpsertCollectionsFromText(ctx, "x", biz.SaveSource{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := cols[0].Collection.ID
+
+	col, err := uc.UpdateStatus(ctx, id, biz.StatusDone)
+	if err != nil || col.ReadAt == nil {
+		t.Fatalf("done: %+v, %v; want ReadAt set", col, err)
+	}
+	col, err = uc.UpdateStatus(ctx, id, biz.StatusArchived)
+	if err != nil || col.ReadAt == nil {
+		t.Fatalf("archived: %+v, %v; want ReadAt kept", col, err)
+	}
+	if _, err := uc.UpdateStatus(ctx, id, biz.StatusDone); !errors.Is(err, biz.ErrInvalidArgument) {
+		t.Errorf("archived -> done: got %v, want ErrInvalidArgument", err)
+	}
+	col, err = uc.UpdateStatus(ctx, id, biz.StatusUnread)
+	if err != nil || col.ReadAt != nil {
+		t.Errorf("unread: %+v, %v; want ReadAt cleared", col, err)
+	}
+	if _, err := uc.UpdateStatus(ctx, id, "later"); !errors.Is(err, biz.ErrInvalidArgument) {
+		t.Errorf("unknown status: got %v, want ErrInvalidArgument", err)
+	}
+}
+
+// hostExtractor maps a link to the origin of the first matching prefix and
+// rejects the rest.
+type hostExtractor map[string]string
+
+func (h hostExtractor) ExtractAll(ctx context.Context, text string) ([]biz.URLOriPair, error) {
+	report, _ := h.Extract(ctx, text)
+	return report.Pairs(), nil
+}
+
+func (h hostExtractor) KnownOrigin(string) bool { return true }
+
+func (h hostExtractor) Extract(_ context.Context, text string) (*biz.ExtractReport, error) {
+	c := &biz.ExtractCandidate{Text: text, Key: text}
+	c.Reject(biz.RejectUnsupportedHost, "unsupported")
+	for prefix, origin := range h {
+		if strings.HasPrefix(text, prefix) {
+			c.Status, c.Reason, c.Detail, c.Origin = biz.ExtractAccepted, "", "", origin
+			c.Pair = &biz.URLOriPair{URL: text, CanonicalURL: text, Origin: origin}
+		}
+	}
+	return &biz.ExtractReport{Candidates: []*biz.ExtractCandidate{c}}, nil
+}
+
+func TestReclassify(t *testing.T) {
+	ctx := context.Background()
+	repo := data.NewMemoryRepo()
+	for _, c := range []struct{ id, url, origin string }{
+		{"1", "https://a.com/1", "Old"},
+		{"2", "https://a.com/2", "A"},
+		{"3", "https://b.com/1", "Old"},
+		{"4", "https://gone.com/1", "Old"},
+		{"5", "https://b.com/2", "B"},
+	} {
+		col := &biz.Collection{ID: c.id, URL: c.url, Origin: c.origin, CreatedAt: time.Now()}
+		if _, err := repo.UpsertCollection(ctx, col, biz.CollectionEvent{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Delete(ctx, "3"); err != nil {
+		t.Fatal(err)
+	}
+	uc := biz.NewCollectionUsecase(repo, hostExtractor{"https://a.com/": "A", "https://b.com/": "B"})
+	// origins lists every collection's origin, trashed ones included, by ID
+	origins := func() []string {
+		cols, err := repo.ListAfter(ctx, "", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make([]string, len(cols))
+		for i, c := range cols {
+			out[i] = c.Origin
+		}
+		return out
+	}
+
+	dry, err := uc.Reclassify(ctx, biz.ReclassifyOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dry.Scanned != 5 || dry.Changed != 2 || dry.Unmatched != 1 || dry.Next != "" || len(dry.Changes) != 2 {
+		t.Errorf("dry run = %+v, want 5 scanned, 2 changed, 1 unmatched", dry)
+	}
+	if len(dry.Moves) != 2 || dry.Moves[0].From != "Old" || dry.Moves[0].To != "A" || dry.Moves[1].To != "B" {
+		t.Errorf("dry run moves = %v, want Old -> A and Old -> B", dry.Moves)
+	}
+	if got := origins(); !slices.Equal(got, []string{"Old", "A", "Old", "Old", "B"}) {
+		t.Fatalf("dry run wrote origins: %v", got)
+	}
+
+	// an interrupted run reports where it stopped and nothing past it
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if r, err := uc.Reclassify(cancelled, biz.ReclassifyOptions{After: "1"}); !errors.Is(err, context.Canceled) || r.Next != "1" || r.Scanned != 0 {
+		t.Errorf("cancelled run = %+v, %v; want Next 1 and context.Canceled", r, err)
+	}
+
+	// a run stopped by Limit resumes from Next
+	first, err := uc.Reclassify(ctx, biz.ReclassifyOptions{Limit: 2, BatchSize: 1})
+	if err != nil || first.Scanned != 2 || first.Changed != 1 || first.Next != "2" {
+		t.Fatalf("first part = %+v, %v; want 2 scanned, 1 changed, Next 2", first, err)
+	}
+	rest, err := uc.Reclassify(ctx, biz.ReclassifyOptions{After: first.Next, BatchSize: 2})
+	if err != nil || rest.Scanned != 3 || rest.Changed != 1 || rest.Next != "" {
+		t.Fatalf("rest = %+v, %v; want 3 scanned, 1 changed, done", rest, err)
+	}
+	if got := origins(); !slices.Equal(got, []string{"A", "A", "B", "Old", "B"}) {
+		t.Errorf("origins after reclassify = %v", got)
+	}
+}
+
+// editingRepo edits a collection's origin right before SetOrigins runs, as a
+// PATCH landing mid-reclassify would.
+type editingRepo struct {
+	biz.CollectionRepo
+	id, origin string
+}
+
+func (r editingRepo) SetOrigins(ctx context.Context, changes []*biz.OriginChange) ([]*biz.OriginChange, error) {
+	if err := r.Update(ctx, &biz.Collection{ID: r.id, Origin: r.origin}); err != nil {
+		return nil, err
+	}
+	return r.CollectionRepo.SetOrigins(ctx, changes)
+}
+
+func TestReclassifyKeepsConcurrentEdits(t *testing.T) {
+	ctx := context.Background()
+	repo := data.NewMemoryRepo()
+	for _, id := range []string{"1", "2"} {
+		col := &biz.Collection{ID: id, URL: "https://a.com/" + id, Origin: "Old", CreatedAt: time.Now()}
+		if _, err := repo.UpsertCollection(ctx, col, biz.CollectionEvent{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	uc := biz.NewCollectionUsecase(editingRepo{repo, "2", "Mine"}, hostExtractor{"https://a.com/": "A"})
+	report, err := uc.Reclassify(ctx, biz.ReclassifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Changed != 1 || report.Skipped != 1 || len(report.Changes) != 1 || report.Changes[0].ID != "1" {
+		t.Errorf("report = %+v, want 1 moved and the edited one skipped", report)
+	}
+	if c, _ := repo.GetByID(ctx, "2"); c == nil || c.Origin != "Mine" {
+		t.Errorf("edited collection = %+v, want origin Mine kept", c)
+	}
+}
+
+func TestImportBookmarksReport(t *testing.T) {
+	ctx := context.Background()
+	repo := data.NewMemoryRepo()
+	for _, c := range []struct{ id, url string }{{"kept", "https://a.com/kept"}, {"binned", "https://a.com/binned"}} {
+		col := &biz.Collection{ID: c.id, URL: c.url, Origin: "A", Title: c.id, CreatedAt: time.Now()}
+		if _, err := repo.UpsertCollection(ctx, col, biz.CollectionEvent{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Delete(ctx, "binned"); err != nil {
+		t.Fatal(err)
+	}
+	uc := biz.NewCollectionUsecase(repo, hostExtractor{"https://a.com/": "A"})
+
+	added := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	report, err := uc.ImportBookmarks(ctx, []biz.Bookmark{
+		{URL: "https://a.com/new", Title: "new", AddDate: added, Folders: []string{"Go", strings.Repeat("x", 65), " go "}},
+		{URL: "https://a.com/kept", AddDate: added},
+		{URL: "https://a.com/binned", AddDate: added},
+		{URL: "https://b.com/x"},
+	}, biz.SaveSource{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []biz.ImportStatus
+	for _, item := range report.Items {
+		statuses = append(statuses, item.Status)
+	}
+	want := []biz.ImportStatus{biz.ImportImported, biz.ImportDuplicate, biz.ImportTrashed, biz.ImportUnsupported}
+	if !slices.Equal(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+	if report.Imported != 1 || report.Duplicates != 1 || report.Trashed != 1 || report.Unsupported != 1 || report.Failed != 0 {
+		t.Errorf("report counts = %+v", report)
+	}
+	if report.Items[1].CollectionID != "kept" || report.Items[2].CollectionID != "binned" {
+		t.Errorf("existing links reported as %q, %q", report.Items[1].CollectionID, report.Items[2].CollectionID)
+	}
+
+	got, err := repo.GetByID(ctx, report.Items[0].CollectionID)
+	if err != nil || !got.CreatedAt.Equal(added) || !slices.Equal(got.Tags, []string{"go"}) {
+		t.Errorf("imported = %+v, %v; want created at AddDate and tagged go", got, err)
+	}
+	// the folder name too long for a tag is skipped, not the whole path
+	if r := report.Items[0].Reason; !strings.Contains(r, strings.Repeat("x", 65)) {
+		t.Errorf("imported reason = %q, want the skipped folder named", r)
+	}
+	// existing links are left untouched, and a trashed one stays in the trash
+	if got, err := repo.GetByID(ctx, "kept"); err != nil || got.CreatedAt.Equal(added) || got.SaveCount != 1 {
+		t.Errorf("kept = %+v, %v; want it untouched", got, err)
+	}
+	if _, err := repo.GetByID(ctx, "binned"); !errors.Is(err, biz.ErrNotFound) {
+		t.Errorf("GetByID(binned) = %v, want it still trashed", err)
+	}
+}
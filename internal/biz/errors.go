@@ -5,7 +5,10 @@ import (
 )
 
 type myerror struct {
-	s string
+	// kind is the message of the root error; it survives WithMessage so
+	// errors.Is(err, ErrInvalidArgument) matches decorated errors too.
+	kind string
+	s    string
 }
 
 func (me myerror) Error() string {
@@ -17,10 +20,17 @@ func (me myerror) Error() string {
 // exposes the WithMessage method (we frequently use ErrInvaildArgument.WithMessage(...)).
 func NewMyError(s string) myerror {
 	return myerror{
-		s: s,
+		kind: s,
+		s:    s,
 	}
 }
 
+// Is reports whether target is a myerror of the same kind.
+func (me myerror) Is(target error) bool {
+	t, ok := target.(myerror)
+	return ok && t.kind == me.kind
+}
+
 // WithMessage appends the provided message to the error string and returns a new myerror.
 func (me myerror) WithMessage(str string) myerror {
 	var builder strings.Builder
@@ -29,7 +39,8 @@ func (me myerror) WithMessage(str string) myerror {
 	builder.WriteString(": ")
 	builder.WriteString(str)
 	return myerror{
-		s: builder.String(),
+		kind: me.kind,
+		s:    builder.String(),
 	}
 
 }
@@ -40,5 +51,7 @@ var (
 	// ErrInvaildArgument.WithMessage("origin cannot be empty").
 	ErrInvalidArgument myerror = NewMyError("invaild argument")
 	ErrNotFound        myerror = NewMyError("not found")
-	ErrInternalError   myerror = NewMyError("internal error")
+	// ErrConflict reports a write that collides with an existing record.
+	ErrConflict      myerror = NewMyError("conflict")
+	ErrInternalError myerror = NewMyError("internal error")
 )
@@ -0,0 +1,46 @@
+package biz
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// CollectionEvent records one save of a collection.
+type CollectionEvent struct {
+	ID           int64     `json:"id"`
+	CollectionID string    `json:"collection_id"`
+	SavedAt      time.Time `json:"saved_at"`
+	// SourceHash is the hex SHA-256 of the text the link was extracted from,
+	// so repeated shares of the same text can be told apart from new ones.
+	SourceHash string `json:"source_hash"`
+	// Client names what sent the save, e.g. an X-Client header or User-Agent.
+	Client    string `json:"client"`
+	RequestID string `json:"request_id"`
+}
+
+// SaveSource describes who is saving, for the event log.
+type SaveSource struct {
+	Client    string
+	RequestID string
+}
+
+// event builds the event recorded for saving a link found in text.
+func (src SaveSource) event(text string) CollectionEvent {
+	sum := sha256.Sum256([]byte(text))
+	return CollectionEvent{
+		SavedAt:    time.Now(),
+		SourceHash: hex.EncodeToString(sum[:]),
+		Client:     src.Client,
+		RequestID:  src.RequestID,
+	}
+}
+
+// History returns the saves of a live collection, newest first.
+func (uc *CollectionUsecase) History(ctx context.Context, id string) ([]*CollectionEvent, error) {
+	if id == "" {
+		return nil, ErrInvalidArgument.WithMessage("id cannot be empty")
+	}
+	return uc.repo.ListEvents(ctx, id)
+}
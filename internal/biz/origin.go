@@ -5,8 +5,77 @@ import "context"
 // URLOriPair represents a single extracted URL and its mapped Origin.
 // This is what outer layers (usecase/service) consume to create Collections.
 type URLOriPair struct {
-	URL    string
+	// URL is the link exactly as it appeared in the input text.
+	URL string
+	// CanonicalURL is URL with tracking parameters stripped and the
+	// origin's normalization rules applied; it is the deduplication key.
+	CanonicalURL string
+	Origin       string
+	// ContentType and ContentID identify the item within its origin
+	// (e.g. "video"/"BV1xx411c7mD"). Both are empty when no rule matched.
+	ContentType string
+	ContentID   string
+	// Title is taken from the share text around the link; may be empty.
+	Title string
+}
+
+// ExtractStatus says whether a candidate link will be saved.
+type ExtractStatus string
+
+const (
+	ExtractAccepted ExtractStatus = "accepted"
+	ExtractRejected ExtractStatus = "rejected"
+)
+
+// RejectReason explains why a candidate link was rejected.
+type RejectReason string
+
+const (
+	RejectBadScheme       RejectReason = "bad_scheme"
+	RejectInvalidURL      RejectReason = "invalid_url"
+	RejectUnsupportedHost RejectReason = "unsupported_host"
+	RejectShortLink       RejectReason = "short_link_unresolved"
+	RejectDuplicate       RejectReason = "duplicate"
+)
+
+// ExtractCandidate reports on one substring of the input that looked like a
+// link.
+type ExtractCandidate struct {
+	Text   string
+	Status ExtractStatus
+	// Reason is empty for accepted candidates; Detail explains it.
+	Reason RejectReason
+	Detail string
+	// Key is the normalized URL used for de-duplication and Origin the origin
+	// the host mapped to; each is empty when the link did not get that far.
+	Key    string
 	Origin string
+	// Unmapped is set when Origin comes from the unmapped-host policy (the
+	// fallback origin or one derived from the host) rather than a configured entry.
+	Unmapped bool
+	// Pair is what gets saved; nil unless accepted.
+	Pair *URLOriPair
+}
+
+// Reject marks the candidate rejected for reason.
+func (c *ExtractCandidate) Reject(reason RejectReason, detail string) {
+	c.Status, c.Reason, c.Detail, c.Pair = ExtractRejected, reason, detail, nil
+}
+
+// ExtractReport lists every candidate link in input order.
+type ExtractReport struct {
+	Candidates []*ExtractCandidate
+}
+
+// Pairs returns the accepted candidates' pairs.
+func (r *ExtractReport) Pairs() []URLOriPair {
+	var pairs []URLOriPair
+	for _, c := range r.Candidates {
+		if c.Status == ExtractAccepted {
+			pairs = append(pairs, *c.Pair)
+		}
+	}
+	return pairs
 }
 
 // OriginExtractor now returns all URL:Origin pairs discovered in input text.
@@ -14,4 +83,35 @@ type URLOriPair struct {
 // They SHOULD de-duplicate identical URL+Origin pairs.
 type OriginExtractor interface {
 	ExtractAll(ctx context.Context, rawText string) ([]URLOriPair, error)
+	// Extract is ExtractAll with a verdict for every candidate link, rejected
+	// ones included. It returns ErrInvalidArgument when rawText is empty or
+	// holds nothing that looks like a link; text whose links are all rejected
+	// still gets a report and a nil error.
+	Extract(ctx context.Context, rawText string) (*ExtractReport, error)
+	// KnownOrigin reports whether origin is configured rather than derived
+	// from a host by the unmapped-host policy.
+	KnownOrigin(origin string) bool
+}
+
+// OriginCount is an origin together with the number of live collections in it.
+type OriginCount struct {
+	Origin string
+	Count  int64
+}
+
+// DerivedOrigins lists the origins of live collections that are not
+// configured, busiest first. With the "derive" unmapped-host policy each is
+// the host it was derived from, ready to be promoted into a proper entry.
+func (uc *CollectionUsecase) DerivedOrigins(ctx context.Context) ([]*OriginCount, error) {
+	all, err := uc.repo.ListOrigins(ctx)
+	if err != nil {
+		return nil, err
+	}
+	derived := make([]*OriginCount, 0, len(all))
+	for _, o := range all {
+		if !uc.originex.KnownOrigin(o.Origin) {
+			derived = append(derived, o)
+		}
+	}
+	return derived, nil
 }
@@ -0,0 +1,132 @@
+package biz
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Origin is a configured site: links matching the Host pattern (an exact
+// host or a "*." wildcard domain, optionally followed by a path prefix) are
+// filed under Name, and the most specific matching pattern wins. The rule
+// fields hold the JSON of the matching origin.json item keys ("canonical",
+// "content_ids", "share_text"); nil means the item has none.
+type Origin struct {
+	ID   int64
+	Host string
+	Name string
+	// Icon is an image URL shown next to the name; may be empty.
+	Icon       string
+	Canonical  json.RawMessage
+	ContentIDs json.RawMessage
+	ShareText  json.RawMessage
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// OriginRepo stores the configured origins.
+type OriginRepo interface {
+	// List returns every origin ordered by host.
+	List(ctx context.Context) ([]*Origin, error)
+	// Get, Update and Delete return ErrNotFound for an unknown id.
+	Get(ctx context.Context, id int64) (*Origin, error)
+	// Create and Update store Host in its canonical spelling. They return
+	// ErrConflict when another origin has an equivalent host pattern and
+	// ErrInvalidArgument when the pattern or the rules don't parse.
+	Create(ctx context.Context, o *Origin) error
+	Update(ctx context.Context, o *Origin) error
+	Delete(ctx context.Context, id int64) error
+	// Seed adds, in a single transaction, each of origins whose host was never
+	// seeded before and isn't taken, and remembers the hosts so an origin
+	// deleted later isn't brought back. It returns how many were added.
+	Seed(ctx context.Context, origins []*Origin) (int, error)
+}
+
+// OriginCache is told when origins change so it can drop what it cached.
+type OriginCache interface {
+	Invalidate()
+}
+
+type OriginUsecase struct {
+	repo  OriginRepo
+	cache OriginCache
+}
+
+// NewOriginUsecase builds the origin management usecase; cache may be nil.
+func NewOriginUsecase(repo OriginRepo, cache OriginCache) *OriginUsecase {
+	return &OriginUsecase{repo: repo, cache: cache}
+}
+
+func (uc *OriginUsecase) List(ctx context.Context) ([]*Origin, error) {
+	return uc.repo.List(ctx)
+}
+
+func (uc *OriginUsecase) Get(ctx context.Context, id int64) (*Origin, error) {
+	return uc.repo.Get(ctx, id)
+}
+
+func (uc *OriginUsecase) Create(ctx context.Context, o *Origin) (*Origin, error) {
+	if err := normalizeOrigin(o); err != nil {
+		return nil, err
+	}
+	if err := uc.repo.Create(ctx, o); err != nil {
+		return nil, err
+	}
+	uc.invalidate()
+	return o, nil
+}
+
+// Update replaces every field of origin o.ID.
+func (uc *OriginUsecase) Update(ctx context.Context, o *Origin) (*Origin, error) {
+	if err := normalizeOrigin(o); err != nil {
+		return nil, err
+	}
+	if err := uc.repo.Update(ctx, o); err != nil {
+		return nil, err
+	}
+	uc.invalidate()
+	return o, nil
+}
+
+func (uc *OriginUsecase) Delete(ctx context.Context, id int64) error {
+	if err := uc.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	uc.invalidate()
+	return nil
+}
+
+func (uc *OriginUsecase) invalidate() {
+	if uc.cache != nil {
+		uc.cache.Invalidate()
+	}
+}
+
+// normalizeOrigin trims o and checks the fields every store needs; the rules
+// are checked by the repo, which knows how they are interpreted.
+func normalizeOrigin(o *Origin) error {
+	// only the host part is case-insensitive, not a path prefix after it
+	host, path, hasPath := strings.Cut(strings.TrimSpace(o.Host), "/")
+	o.Host = strings.ToLower(host)
+	if hasPath {
+		o.Host += "/" + path
+	}
+	o.Name = strings.TrimSpace(o.Name)
+	o.Icon = strings.TrimSpace(o.Icon)
+	switch {
+	case o.Host == "":
+		return ErrInvalidArgument.WithMessage("host cannot be empty")
+	case strings.Contains(o.Host, "://"):
+		return ErrInvalidArgument.WithMessage("host must not include a scheme")
+	case strings.ContainsAny(o.Host, " \t\r\n?#"):
+		return ErrInvalidArgument.WithMessage("host must be a host pattern, e.g. bilibili.com, *.163.com or mp.weixin.qq.com/s")
+	case len(o.Host) > 255:
+		return ErrInvalidArgument.WithMessage("host is too long")
+	case o.Name == "":
+		return ErrInvalidArgument.WithMessage("name cannot be empty")
+	case len(o.Name) > 255:
+		return ErrInvalidArgument.WithMessage("name is too long")
+	}
+	return nil
+}
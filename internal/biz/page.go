@@ -0,0 +1,97 @@
+package biz
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+
+	DefaultPerOriginLimit = 10
+	MaxPerOriginLimit     = 100
+)
+
+// PageRequest asks for up to Limit collections after Cursor. An empty
+// Cursor starts from the beginning.
+type PageRequest struct {
+	Cursor string
+	Limit  int
+}
+
+// Page is one page of collections. NextCursor is empty on the last page.
+type Page struct {
+	Items      []*Collection
+	NextCursor string
+}
+
+// Cursor is the decoded position of a page boundary: list queries are
+// ordered by (CreatedAt, ID), so the pair identifies a row uniquely.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Encode returns the opaque form handed to clients.
+func (c Cursor) Encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// CursorAfter returns the cursor pointing just past col.
+func CursorAfter(col *Collection) string {
+	return Cursor{CreatedAt: col.CreatedAt, ID: col.ID}.Encode()
+}
+
+// DecodeCursor parses an opaque cursor. An empty string yields nil.
+func DecodeCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidArgument.WithMessage("malformed cursor")
+	}
+	nanos, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return nil, ErrInvalidArgument.WithMessage("malformed cursor")
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidArgument.WithMessage("malformed cursor")
+	}
+	return &Cursor{CreatedAt: time.Unix(0, n), ID: id}, nil
+}
+
+// normalize validates the cursor and clamps Limit into [1, MaxPageLimit].
+func (p PageRequest) normalize() (PageRequest, error) {
+	if _, err := DecodeCursor(p.Cursor); err != nil {
+		return p, err
+	}
+	if p.Limit < 0 {
+		return p, ErrInvalidArgument.WithMessage("limit can't be negative")
+	}
+	if p.Limit == 0 {
+		p.Limit = DefaultPageLimit
+	}
+	if p.Limit > MaxPageLimit {
+		p.Limit = MaxPageLimit
+	}
+	return p, nil
+}
+
+// normalizePerOrigin clamps the grouped view's per-origin limit.
+func normalizePerOrigin(n int) (int, error) {
+	switch {
+	case n < 0:
+		return 0, ErrInvalidArgument.WithMessage("per_origin can't be negative")
+	case n == 0:
+		return DefaultPerOriginLimit, nil
+	case n > MaxPerOriginLimit:
+		return MaxPerOriginLimit, nil
+	}
+	return n, nil
+}
@@ -0,0 +1,163 @@
+package biz
+
+import (
+	"context"
+	"strings"
+
+	"github/heimaolst/collectionbox/internal/logx"
+)
+
+// ReclassifyOptions controls a Reclassify run.
+type ReclassifyOptions struct {
+	// DryRun reports what would change without writing anything.
+	DryRun bool
+	// After resumes an earlier run: only collections whose ID sorts after it
+	// are looked at. Pass the Next of the previous report.
+	After string
+	// Limit stops the run after that many collections; 0 means all of them.
+	Limit int
+	// BatchSize is how many collections are read and updated at a time.
+	BatchSize int
+}
+
+const defaultReclassifyBatch = 200
+
+// maxReportedChanges bounds ReclassifyReport.Changes; Moves still counts all.
+const maxReportedChanges = 100
+
+// OriginChange is one collection whose origin the current rules disagree with.
+type OriginChange struct {
+	ID   string
+	URL  string
+	From string
+	To   string
+}
+
+// OriginMove counts the collections moving from one origin to another.
+type OriginMove struct {
+	From  string
+	To    string
+	Count int
+}
+
+// ReclassifyReport sums up a Reclassify run.
+type ReclassifyReport struct {
+	DryRun  bool
+	Scanned int
+	// Changed counts the collections that moved, or would move in a dry run.
+	Changed int
+	// Unmatched counts collections the current rules reject, e.g. because
+	// their host is no longer configured; they keep their origin.
+	Unmatched int
+	// Skipped counts collections whose origin was edited between being read
+	// and being moved; the edit is kept.
+	Skipped int
+	Moves   []*OriginMove
+	// Changes lists the first maxReportedChanges changes.
+	Changes []*OriginChange
+	// Next is the After that continues this run; "" once every collection
+	// has been looked at.
+	Next string
+}
+
+func (r *ReclassifyReport) add(c *OriginChange) {
+	r.Changed++
+	if len(r.Changes) < maxReportedChanges {
+		r.Changes = append(r.Changes, c)
+	}
+	for _, m := range r.Moves {
+		if m.From == c.From && m.To == c.To {
+			m.Count++
+			return
+		}
+	}
+	r.Moves = append(r.Moves, &OriginMove{From: c.From, To: c.To, Count: 1})
+}
+
+// Reclassify runs the URL of every collection, trashed ones included,
+// through the current origin rules and moves the ones whose origin changed,
+// one batch per transaction. Origins set by hand are overwritten too, unless
+// they are set while the run is under way.
+//
+// Collections are visited in ID order and the report's Next says where to
+// pick up, so a run that is interrupted or stopped by Limit can be resumed;
+// the report then covers the part that was done. Running it again over
+// collections already visited is harmless.
+func (uc *CollectionUsecase) Reclassify(ctx context.Context, opts ReclassifyOptions) (*ReclassifyReport, error) {
+	if opts.Limit < 0 {
+		return nil, ErrInvalidArgument.WithMessage("limit must not be negative")
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultReclassifyBatch
+	}
+	log := logx.FromContext(ctx)
+	report := &ReclassifyReport{DryRun: opts.DryRun, Next: opts.After}
+	for opts.Limit == 0 || report.Scanned < opts.Limit {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		n := batchSize
+		if opts.Limit > 0 {
+			n = min(n, opts.Limit-report.Scanned)
+		}
+		cols, err := uc.repo.ListAfter(ctx, report.Next, n)
+		if err != nil {
+			return report, err
+		}
+		if len(cols) == 0 {
+			report.Next = ""
+			return report, nil
+		}
+
+		var changes []*OriginChange
+		unmatched := 0
+		for _, col := range cols {
+			origin, ok := uc.classify(ctx, col.URL)
+			switch {
+			case !ok:
+				unmatched++
+			case origin != col.Origin:
+				changes = append(changes, &OriginChange{ID: col.ID, URL: col.URL, From: col.Origin, To: origin})
+			}
+		}
+		applied := changes
+		if !opts.DryRun && len(changes) > 0 {
+			if applied, err = uc.repo.SetOrigins(ctx, changes); err != nil {
+				return report, err
+			}
+		}
+		// the batch only counts once it is written, so Next never skips rows
+		report.Scanned += len(cols)
+		report.Unmatched += unmatched
+		report.Skipped += len(changes) - len(applied)
+		for _, c := range applied {
+			report.add(c)
+		}
+		report.Next = cols[len(cols)-1].ID
+		log.Info("reclassify batch done", "dry_run", opts.DryRun, "scanned", report.Scanned,
+			"changed", report.Changed, "unmatched", report.Unmatched, "skipped", report.Skipped, "next", report.Next)
+		if len(cols) < n {
+			report.Next = ""
+			return report, nil
+		}
+	}
+	return report, nil
+}
+
+// classify returns the origin the current rules give url, false when they
+// reject it.
+func (uc *CollectionUsecase) classify(ctx context.Context, url string) (string, bool) {
+	if strings.TrimSpace(url) == "" {
+		return "", false
+	}
+	report, err := uc.originex.Extract(ctx, url)
+	if err != nil || len(report.Candidates) == 0 {
+		return "", false
+	}
+	c := report.Candidates[0]
+	if c.Status != ExtractAccepted {
+		return "", false
+	}
+	return c.Origin, true
+}
@@ -0,0 +1,152 @@
+package repotest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github/heimaolst/collectionbox/internal/biz"
+)
+
+// RunOrigins is the contract for biz.OriginRepo; newRepo must return an
+// empty repository.
+func RunOrigins(t *testing.T, newRepo func(t *testing.T) biz.OriginRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+
+	bili := &biz.Origin{
+		Host:       "bilibili.com",
+		Name:       "Bilibili",
+		Icon:       "https://www.bilibili.com/favicon.ico",
+		Canonical:  json.RawMessage(`{"drop_query":["vd_source"]}`),
+		ContentIDs: json.RawMessage(`[{"type":"video","pattern":"/video/(?P<id>BV[0-9A-Za-z]{10})"}]`),
+	}
+	if err := repo.Create(ctx, bili); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if bili.ID == 0 || bili.CreatedAt.IsZero() {
+		t.Fatalf("Create left ID = %d, CreatedAt = %v", bili.ID, bili.CreatedAt)
+	}
+	if err := repo.Create(ctx, &biz.Origin{Host: "zhihu.com", Name: "Zhihu"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	got, err := repo.Get(ctx, bili.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Host != bili.Host || got.Name != bili.Name || got.Icon != bili.Icon {
+		t.Errorf("Get = %+v, want %+v", got, bili)
+	}
+	if string(got.Canonical) != string(bili.Canonical) || string(got.ContentIDs) != string(bili.ContentIDs) || got.ShareText != nil {
+		t.Errorf("rules = %s %s %s, want them as created", got.Canonical, got.ContentIDs, got.ShareText)
+	}
+
+	if err := repo.Create(ctx, &biz.Origin{Host: "bilibili.com", Name: "Again"}); !errors.Is(err, biz.ErrConflict) {
+		t.Errorf("Create duplicate host = %v, want ErrConflict", err)
+	}
+	// the same pattern spelled differently is still a duplicate
+	if err := repo.Create(ctx, &biz.Origin{Host: "*.bilibili.com", Name: "Again"}); !errors.Is(err, biz.ErrConflict) {
+		t.Errorf("Create *.bilibili.com = %v, want ErrConflict", err)
+	}
+	mp := &biz.Origin{Host: "mp.weixin.qq.com/s/", Name: "WeChat"}
+	if err := repo.Create(ctx, mp); err != nil || mp.Host != "mp.weixin.qq.com/s" {
+		t.Errorf("Create path pattern = %q, %v; want host mp.weixin.qq.com/s", mp.Host, err)
+	}
+	if err := repo.Delete(ctx, mp.ID); err != nil {
+		t.Fatal(err)
+	}
+	bad := &biz.Origin{Host: "bad.com", Name: "Bad", ContentIDs: json.RawMessage(`[{"type":"x","pattern":"("}]`)}
+	if err := repo.Create(ctx, bad); !errors.Is(err, biz.ErrInvalidArgument) {
+		t.Errorf("Create with a broken pattern = %v, want ErrInvalidArgument", err)
+	}
+
+	got.Name, got.Canonical = "哔哩哔哩", nil
+	if err := repo.Update(ctx, got); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	got, _ = repo.Get(ctx, bili.ID)
+	if got.Name != "哔哩哔哩" || got.Canonical != nil || got.ContentIDs == nil {
+		t.Errorf("after Update = %+v", got)
+	}
+	got.Host = "zhihu.com"
+	if err := repo.Update(ctx, got); !errors.Is(err, biz.ErrConflict) {
+		t.Errorf("Update onto a taken host = %v, want ErrConflict", err)
+	}
+	if err := repo.Update(ctx, &biz.Origin{ID: 9999, Host: "x.com", Name: "X"}); !errors.Is(err, biz.ErrNotFound) {
+		t.Errorf("Update unknown id = %v, want ErrNotFound", err)
+	}
+
+	list, err := repo.List(ctx)
+	if err != nil || len(list) != 2 || list[0].Host != "bilibili.com" || list[1].Host != "zhihu.com" {
+		t.Fatalf("List = %v, %v; want bilibili.com, zhihu.com", list, err)
+	}
+
+	if err := repo.Delete(ctx, bili.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := repo.Get(ctx, bili.ID); !errors.Is(err, biz.ErrNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrNotFound", err)
+	}
+	if err := repo.Delete(ctx, bili.ID); !errors.Is(err, biz.ErrNotFound) {
+		t.Errorf("Delete twice = %v, want ErrNotFound", err)
+	}
+
+	runSeed(t, repo)
+}
+
+// runSeed expects repo to hold zhihu.com, created by hand.
+func runSeed(t *testing.T, repo biz.OriginRepo) {
+	ctx := context.Background()
+	seed := func(hosts ...string) (int, error) {
+		var origins []*biz.Origin
+		for _, h := range hosts {
+			origins = append(origins, &biz.Origin{Host: h, Name: "Seeded " + h})
+		}
+		return repo.Seed(ctx, origins)
+	}
+	hosts := func() []string {
+		list, err := repo.List(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var hs []string
+		for _, o := range list {
+			hs = append(hs, o.Host+"="+o.Name)
+		}
+		return hs
+	}
+
+	// a host taken by hand keeps its origin
+	if n, err := seed("a.com", "*.b.com", "zhihu.com"); err != nil || n != 2 {
+		t.Fatalf("Seed = %d, %v; want 2", n, err)
+	}
+	want := []string{"a.com=Seeded a.com", "b.com=Seeded *.b.com", "zhihu.com=Zhihu"}
+	if got := hosts(); !slices.Equal(got, want) {
+		t.Errorf("after Seed = %v, want %v", got, want)
+	}
+
+	// seeded hosts are never seeded again, even once deleted
+	list, _ := repo.List(ctx)
+	if err := repo.Delete(ctx, list[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := seed("a.com", "b.com", "c.com", "zhihu.com"); err != nil || n != 1 {
+		t.Errorf("Seed again = %d, %v; want only c.com", n, err)
+	}
+	want = []string{"b.com=Seeded *.b.com", "c.com=Seeded c.com", "zhihu.com=Zhihu"}
+	if got := hosts(); !slices.Equal(got, want) {
+		t.Errorf("after seeding again = %v, want %v", got, want)
+	}
+
+	// one bad item and nothing is seeded
+	bad := []*biz.Origin{{Host: "d.com", Name: "D"}, {Host: "e.com", Name: "E", Canonical: json.RawMessage(`{"nope":1}`)}}
+	if n, err := repo.Seed(ctx, bad); !errors.Is(err, biz.ErrInvalidArgument) || n != 0 {
+		t.Errorf("Seed with a bad rule = %d, %v; want ErrInvalidArgument", n, err)
+	}
+	if n, err := seed("d.com"); err != nil || n != 1 {
+		t.Errorf("Seed after a failed one = %d, %v; want d.com added", n, err)
+	}
+}
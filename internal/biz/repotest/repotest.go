@@ -0,0 +1,650 @@
+// Package repotest is the contract every biz.CollectionRepo implementation
+// must satisfy. A backend's tests call Run with a constructor for an empty
+// repository:
+//
+//	func TestContract(t *testing.T) {
+//		repotest.Run(t, func(t *testing.T) biz.CollectionRepo { return newRepo(t) })
+//	}
+package repotest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/biz"
+
+	"github.com/google/uuid"
+)
+
+// base is a whole second in UTC so backends with coarse DATETIME columns
+// round-trip it exactly.
+var base = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// Run runs the contract against repositories built by newRepo; every subtest
+// gets a fresh, empty one.
+func Run(t *testing.T, newRepo func(t *testing.T) biz.CollectionRepo) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo biz.CollectionRepo)
+	}{
+		{"Upsert", testUpsert},
+		{"UpsertMany", testUpsertMany},
+		{"GetByContentID", testGetByContentID},
+		{"Paging", testPaging},
+		{"GroupedByOrigin", testGroupedByOrigin},
+		{"UpdateAndTrash", testUpdateAndTrash},
+		{"StatusAndQueue", testStatusAndQueue},
+		{"Tags", testTags},
+		{"Origins", testOrigins},
+		{"ListAfterAndSetOrigins", testListAfterAndSetOrigins},
+		{"StreamAndLatest", testStreamAndLatest},
+		{"Search", testSearch},
+		{"History", testHistory},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newRepo(t))
+		})
+	}
+}
+
+func newCollection(url, origin string, at time.Time) *biz.Collection {
+	return &biz.Collection{
+		ID:        uuid.NewString(),
+		CreatedAt: at,
+		URL:       url,
+		RawURL:    url,
+		Origin:    origin,
+		Title:     "title of " + url,
+		Status:    biz.StatusUnread,
+	}
+}
+
+// save upserts collections built by newCollection, one minute apart starting
+// at base, and returns what the repo stored.
+func save(t *testing.T, repo biz.CollectionRepo, origin string, urls ...string) []*biz.Collection {
+	t.Helper()
+	var saved []*biz.Collection
+	for _, u := range urls {
+		col, err := repo.UpsertCollection(context.Background(), newCollection(u, origin, base.Add(time.Duration(len(saved))*time.Minute)), biz.CollectionEvent{})
+		if err != nil {
+			t.Fatalf("UpsertCollection(%s): %v", u, err)
+		}
+		saved = append(saved, col)
+	}
+	return saved
+}
+
+func ids(cols []*biz.Collection) []string {
+	out := make([]string, 0, len(cols))
+	for _, c := range cols {
+		out = append(out, c.ID)
+	}
+	return out
+}
+
+func wantErr(t *testing.T, what string, err, target error) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Errorf("%s: got error %v, want %v", what, err, target)
+	}
+}
+
+func testUpsert(t *testing.T, repo biz.CollectionRepo) {
+	ctx := context.Background()
+	first := newCollection("https://example.com/a", "Example", base)
+	first.ContentType, first.ContentID = "post", "a"
+	saved, err := repo.UpsertCollection(ctx, first, biz.CollectionEvent{})
+	if err != nil {
+		t.Fatalf("UpsertCollection: %v", err)
+	}
+	if saved.ID != first.ID || saved.Title != first.Title || !saved.CreatedAt.Equal(base) || saved.SaveCount != 1 {
+		t.Errorf("UpsertCollection returned %+v, want the inserted row", saved)
+	}
+
+	// saving the same URL again refreshes the existing row
+	again := newCollection("https://example.com/a", "Example", base.Add(time.Hour))
+	again.RawURL = "https://example.com/a?utm_source=x"
+	again.Title = ""
+	saved, err = repo.UpsertCollection(ctx, again, biz.CollectionEvent{})
+	if err != nil {
+		t.Fatalf("UpsertCollection again: %v", err)
+	}
+	if saved.ID != first.ID || saved.SaveCount != 2 {
+		t.Errorf("re-save ID = %s, SaveCount = %d; want existing %s saved twice", saved.ID, saved.SaveCount, first.ID)
+	}
+	if saved.Title != first.Title {
+		t.Errorf("re-save without title changed title to %q", saved.Title)
+	}
+	if !saved.CreatedAt.Equal(base.Add(time.Hour)) || saved.RawURL != again.RawURL {
+		t.Errorf("re-save did not refresh created_at/raw_url: %+v", saved)
+	}
+
+	got, err := repo.GetByURL(ctx, "https://example.com/a")
+	if err != nil || got.ID != first.ID {
+		t.Errorf("GetByURL = %v, %v; want %s", got, err, first.ID)
+	}
+	got, err = repo.GetByID(ctx, first.ID)
+	if err != nil || got.URL != first.URL || got.Status != biz.StatusUnread {
+		t.Errorf("GetByID = %+v, %v", got, err)
+	}
+	_, err = repo.GetByURL(ctx, "https://example.com/missing")
+	wantErr(t, "GetByURL(missing)", err, biz.ErrNotFound)
+	_, err = repo.GetByID(ctx, "missing")
+	wantErr(t, "GetByID(missing)", err, biz.ErrNotFound)
+}
+
+func testUpsertMany(t *testing.T, repo biz.CollectionRepo) {
+	ctx := context.Background()
+	existing := save(t, repo, "A", "https://a/1")[0]
+
+	batch := []*biz.Collection{
+		newCollection("https://a/2", "A", base),
+		newCollection("https://a/1", "A", base.Add(time.Hour)),
+		newCollection("https://a/3", "A", base),
+	}
+	results, err := repo.UpsertMany(ctx, batch, biz.CollectionEvent{})
+	if err != nil {
+		t.Fatalf("UpsertMany: %v", err)
+	}
+	if len(results) != len(batch) {
+		t.Fatalf("UpsertMany returned %d results, want %d", len(results), len(batch))
+	}
+	for i, want := range []bool{true, false, true} {
+		if results[i].Created != want || results[i].Collection.URL != batch[i].URL {
+			t.Errorf("result %d = %s created=%v, want %s created=%v",
+				i, results[i].Collection.URL, results[i].Created, batch[i].URL, want)
+		}
+	}
+	if got := results[1].Collection; got.ID != existing.ID || got.SaveCount != 2 {
+		t.Errorf("re-saved %+v, want existing %s saved twice", got, existing.ID)
+	}
+
+	// a failing batch writes nothing
+	_, err = repo.UpsertMany(ctx, []*biz.Collection{
+		newCollection("https://a/4", "A", base),
+		newCollection("https://a/4", "A", base),
+	}, biz.CollectionEvent{})
+	wantErr(t, "UpsertMany(duplicate urls)", err, biz.ErrInvalidArgument)
+	clash := newCollection("https://a/5", "A", base)
+	clash.ID = existing.ID
+	if _, err := repo.UpsertMany(ctx, []*biz.Collection{newCollection("https://a/4", "A", base), clash}, biz.CollectionEvent{}); err == nil {
+		t.Error("UpsertMany with a clashing id succeeded")
+	}
+	_, err = repo.GetByURL(ctx, "https://a/4")
+	wantErr(t, "GetByURL after failed batch", err, biz.ErrNotFound)
+	if got, err := repo.GetByID(ctx, existing.ID); err != nil || got.URL != existing.URL {
+		t.Errorf("failed batch changed %s: %+v, %v", existing.ID, got, err)
+	}
+}
+
+func testGetByContentID(t *testing.T, repo biz.CollectionRepo) {
+	ctx := context.Background()
+	col := newCollection("https://example.com/v/1", "Example", base)
+	col.ContentType, col.ContentID = "video", "1"
+	if _, err := repo.UpsertCollection(ctx, col, biz.CollectionEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.GetByContentID(ctx, "Example", "video", "1")
+	if err != nil || got.ID != col.ID {
+		t.Errorf("GetByContentID = %v, %v; want %s", got, err, col.ID)
+	}
+	_, err = repo.GetByContentID(ctx, "Other", "video", "1")
+	wantErr(t, "GetByContentID(other origin)", err, biz.ErrNotFound)
+}
+
+func testPaging(t *testing.T, repo biz.CollectionRepo) {
+	ctx := context.Background()
+	cols := save(t, repo, "A", "https://a/0", "https://a/1", "https://a/2", "https://a/3", "https://a/4")
+	other := save(t, repo, "B", "https://b/0")
+
+	var got []*biz.Collection
+	page := biz.PageRequest{Limit: 2}
+	for range 5 {
+		p, err := repo.GetByOrigin(ctx, "A", biz.TagFilter{}, page)
+		if err != nil {
+			t.Fatalf("GetByOrigin: %v", err)
+		}
+		got = append(got, p.Items...)
+		if p.NextCursor == "" {
+			break
+		}
+		page.Cursor = p.NextCursor
+	}
+	want := ids([]*biz.Collection{cols[4], cols[3], cols[2], cols[1], cols[0]})
+	if !slices.Equal(ids(got), want) {
+		t.Errorf("GetByOrigin pages = %v, want %v", ids(got), want)
+	}
+
+	// the range is inclusive and origin "" spans all origins
+	p, err := repo.GetByTimeRange(ctx, base, base.Add(2*time.Minute), "", biz.TagFilter{}, biz.PageRequest{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetByTimeRange: %v", err)
+	}
+	// other[0] ties with cols[0] on created_at, so only the head is fixed
+	if got := ids(p.Items); len(got) != 4 || got[0] != cols[2].ID || !slices.Contains(got, other[0].ID) {
+		t.Errorf("GetByTimeRange = %v, want 4 items from %s down, including %s", got, cols[2].ID, other[0].ID)
+	}
+	p, err = repo.GetByTimeRange(ctx, base, base.Add(2*time.Minute), "B", biz.TagFilter{}, biz.PageRequest{Limit: 10})
+	if err != nil || !slices.Equal(ids(p.Items), ids(other)) {
+		t.Errorf("GetByTimeRange(B) = %v, %v", p, err)
+	}
+
+	_, err = repo.GetByOrigin(ctx, "A", biz.TagFilter{}, biz.PageRequest{Limit: 2, Cursor: "!!"})
+	wantErr(t, "GetByOrigin(bad cursor)", err, biz.ErrInvalidArgument)
+}
+
+func testGroupedByOrigin(t *testing.T, repo biz.CollectionRepo) {
+	ctx := context.Background()
+	a := save(t, repo, "A", "https://a/0", "https://a/1", "https://a/2", "https://a/3")
+	b := save(t, repo, "B", "https://b/0")
+	c := save(t, repo, "C", "https://c/0")
+	// trashed rows are left out: a/3 would be A's newest and C would be a group
+	for _, col := range []*biz.Collection{a[3], c[0]} {
+		if err := repo.Delete(ctx, col.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+	}
+	groups, err := repo.GetAllGroupedByOrigin(ctx, biz.TagFilter{}, 2)
+	if err != nil {
+		t.Fatalf("GetAllGroupedByOrigin: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups, want A and B", len(groups))
+	}
+	if g := groups["A"]; !slices.Equal(ids(g.Items), ids([]*biz.Collection{a[2], a[1]})) || g.NextCursor == "" {
+		t.Errorf("group A = %v (next %q), want newest two and a cursor", ids(g.Items), g.NextCursor)
+	}
+	if g := groups["B"]; !slices.Equal(ids(g.Items), ids(b)) || g.NextCursor != "" {
+		t.Errorf("group B = %v (next %q), want one item and no cursor", ids(g.Items), g.NextCursor)
+	}
+}
+
+func testUpdateAndTrash(t *testing.T, repo biz.CollectionRepo) {
+	ctx := context.Background()
+	cols := save(t, repo, "A", "https://a/0", "https://a/1")
+	col := cols[0]
+	col.Title, col.Note, col.Origin = "new title", "a note", "B"
+	if err := repo.Update(ctx, col); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	got, err := repo.GetByID(ctx, col.ID)
+	if err != nil || got.Title != "new title" || got.Note != "a note" || got.Origin != "B" {
+		t.Errorf("after Update GetByID = %+v, %v", got, err)
+	}
+	// writing the values a row already has is not a miss
+	if err := repo.Update(ctx, col); err != nil {
+		t.Errorf("Update(unchanged): %v", err)
+	}
+	wantErr(t, "Update(missing)", repo.Update(ctx, &biz.Collection{ID: "missing"}), biz.ErrNotFound)
+
+	if err := repo.Delete(ctx, col.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	_, err = repo.GetByID(ctx, col.ID)
+	wantErr(t, "GetByID(trashed)", err, biz.ErrNotFound)
+	if got, err := repo.GetByURL(ctx, col.URL); err != nil || got.ID != col.ID || got.DeletedAt == nil {
+		t.Errorf("GetByURL(trashed) = %+v, %v; want %s with DeletedAt", got, err, col.ID)
+	}
+	wantErr(t, "Delete(missing)", repo.Delete(ctx, "missing"), biz.ErrNotFound)
+	trash, err := repo.ListTrash(ctx)
+	if err != nil || len(trash) != 1 || trash[0].ID != col.ID || trash[0].DeletedAt == nil {
+		t.Errorf("ListTrash = %v, %v; want [%s] with DeletedAt", trash, err, col.ID)
+	}
+
+	if err := repo.Restore(ctx, col.ID); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if _, err := repo.GetByID(ctx, col.ID); err != nil {
+		t.Errorf("GetByID after Restore: %v", err)
+	}
+	wantErr(t, "Restore(live)", repo.Restore(ctx, col.ID), biz.ErrNotFound)
+
+	if err := repo.Delete(ctx, cols[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := repo.PurgeTrash(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("PurgeTrash(before deletion) = %d, %v; want 0", n, err)
+	}
+	if n, err := repo.PurgeTrash(ctx, time.Now().Add(time.Hour)); err != nil || n != 1 {
+		t.Errorf("PurgeTrash = %d, %v; want 1", n, err)
+	}
+	if trash, _ := repo.ListTrash(ctx); len(trash) != 0 {
+		t.Errorf("trash after purge = %v", ids(trash))
+	}
+	wantErr(t, "Restore(purged)", repo.Restore(ctx, cols[1].ID), biz.ErrNotFound)
+}
+
+func testStatusAndQueue(t *testing.T, repo biz.CollectionRepo) {
+	ctx := context.Background()
+	a := save(t, repo, "A", "https://a/0", "https://a/1", "https://a/2")
+	b := save(t, repo, "B", "https://b/0")
+
+	readAt := base.Add(time.Hour)
+	if err := repo.UpdateStatus(ctx, a[1].ID, biz.StatusDone, &readAt); err != nil {
+		t.Fatalf("UpdateStatus: %v", err)
+	}
+	got, err := repo.GetByID(ctx, a[1].ID)
+	if err != nil || got.Status != biz.StatusDone || got.ReadAt == nil || !got.ReadAt.Equal(readAt) {
+		t.Errorf("after UpdateStatus GetByID = %+v, %v", got, err)
+	}
+	if err := repo.UpdateStatus(ctx, a[1].ID, biz.StatusDone, &readAt); err != nil {
+		t.Errorf("UpdateStatus(unchanged): %v", err)
+	}
+	wantErr(t, "UpdateStatus(missing)", repo.UpdateStatus(ctx, "missing", biz.StatusDone, nil), biz.ErrNotFound)
+
+	p, err := repo.GetQueue(ctx, "", biz.PageRequest{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetQueue: %v", err)
+	}
+	// oldest first; b[0] was saved at the same time as a[0]
+	if len(p.Items) != 3 || p.Items[2].ID != a[2].ID || slices.Contains(ids(p.Items), a[1].ID) {
+		t.Errorf("GetQueue = %v, want unread oldest-first without %s", ids(p.Items), a[1].ID)
+	}
+	p, err = repo.GetQueue(ctx, "B", biz.PageRequest{Limit: 10})
+	if err != nil || !slices.Equal(ids(p.Items), ids(b)) {
+		t.Errorf("GetQueue(B) = %v, %v", p, err)
+	}
+}
+
+func testOrigins(t *testing.T, repo biz.CollectionRepo) {
+	ctx := context.Background()
+	save(t, repo, "A", "https://a/0", "https://a/1")
+	b := save(t, repo, "B", "https://b/0", "https://b/1", "https://b/2")
+	save(t, repo, "C", "https://c/0")
+	if err := repo.Delete(ctx, b[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.ListOrigins(ctx)
+	if err != nil {
+		t.Fatalf("ListOrigins: %v", err)
+	}
+	want := []biz.OriginCount{{Origin: "A", Count: 2}, {Origin: "B", Count: 2}, {Origin: "C", Count: 1}}
+	if len(got) != len(want) {
+		t.Fatalf("ListOrigins returned %d origins, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if *got[i] != want[i] {
+			t.Errorf("ListOrigins[%d] = %+v, want %+v", i, *got[i], want[i])
+		}
+	}
+}
+
+func testListAfterAndSetOrigins(t *testing.T, repo biz.CollectionRepo) {
+	ctx := context.Background()
+	cols := save(t, repo, "Old", "https://a/0", "https://a/1", "https://a/2")
+	if err := repo.Delete(ctx, cols[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	want := ids(cols)
+	slices.Sort(want)
+
+	// trashed collections are listed too, in ID order
+	var got []string
+	after := ""
+	for {
+		page, err := repo.ListAfter(ctx, after, 2)
+		if err != nil {
+			t.Fatalf("ListAfter(%q): %v", after, err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		got = append(got, ids(page)...)
+		after = page[len(page)-1].ID
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ListAfter walked %v, want %v", got, want)
+	}
+
+	// cols[2] is edited after being read, so its change is skipped
+	cols[2].Origin = "Edited"
+	if err := repo.Update(ctx, cols[2]); err != nil {
+		t.Fatal(err)
+	}
+	changes := []*biz.OriginChange{
+		{ID: cols[0].ID, From: "Old", To: "A"},
+		{ID: cols[1].ID, From: "Old", To: "B"},
+		{ID: cols[2].ID, From: "Old", To: "C"},
+		{ID: "missing", From: "Old", To: "D"},
+	}
+	applied, err := repo.SetOrigins(ctx, changes)
+	if err != nil {
+		t.Fatalf("SetOrigins: %v", err)
+	}
+	if !slices.Equal(applied, changes[:2]) {
+		t.Errorf("SetOrigins applied %d changes, want the first 2", len(applied))
+	}
+	if c, _ := repo.GetByID(ctx, cols[0].ID); c == nil || c.Origin != "A" {
+		t.Errorf("origin after SetOrigins = %+v, want A", c)
+	}
+	if c, _ := repo.GetByID(ctx, cols[2].ID); c == nil || c.Origin != "Edited" {
+		t.Errorf("edited collection = %+v, want origin Edited", c)
+	}
+	if err := repo.Restore(ctx, cols[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := repo.GetByID(ctx, cols[1].ID); c == nil || c.Origin != "B" {
+		t.Errorf("trashed collection after SetOrigins = %+v, want origin B", c)
+	}
+}
+
+func testTags(t *testing.T, repo biz.CollectionRepo) {
+	ctx := context.Background()
+	cols := save(t, repo, "A", "https://a/0", "https://a/1", "https://a/2")
+	if err := repo.AddTags(ctx, cols[0].ID, []string{"go", "db"}); err != nil {
+		t.Fatalf("AddTags: %v", err)
+	}
+	if err := repo.AddTags(ctx, cols[1].ID, []string{"go"}); err != nil {
+		t.Fatalf("AddTags: %v", err)
+	}
+	// adding a tag twice is not an error
+	if err := repo.AddTags(ctx, cols[1].ID, []string{"go"}); err != nil {
+		t.Fatalf("AddTags again: %v", err)
+	}
+	wantErr(t, "AddTags(missing)", repo.AddTags(ctx, "missing", []string{"go"}), biz.ErrNotFound)
+
+	got, err := repo.GetByID(ctx, cols[0].ID)
+	if err != nil || !slices.Equal(got.Tags, []string{"db", "go"}) {
+		t.Errorf("tags = %v, %v; want [db go]", got.Tags, err)
+	}
+
+	p, err := repo.GetByOrigin(ctx, "A", biz.TagFilter{Tags: []string{"go", "db"}}, biz.PageRequest{Limit: 10})
+	if err != nil || !slices.Equal(ids(p.Items), ids([]*biz.Collection{cols[1], cols[0]})) {
+		t.Errorf("any of [go db] = %v, %v", ids(p.Items), err)
+	}
+	p, err = repo.GetByOrigin(ctx, "A", biz.TagFilter{Tags: []string{"go", "db"}, MatchAll: true}, biz.PageRequest{Limit: 10})
+	if err != nil || !slices.Equal(ids(p.Items), ids(cols[:1])) {
+		t.Errorf("all of [go db] = %v, %v", ids(p.Items), err)
+	}
+
+	counts := func() map[string]int64 {
+		t.Helper()
+		tags, err := repo.ListTags(ctx)
+		if err != nil {
+			t.Fatalf("ListTags: %v", err)
+		}
+		m := make(map[string]int64)
+		for _, tc := range tags {
+			m[tc.Name] = tc.Count
+		}
+		return m
+	}
+	if c := counts(); c["go"] != 2 || c["db"] != 1 {
+		t.Errorf("ListTags = %v, want go:2 db:1", c)
+	}
+
+	if err := repo.RemoveTag(ctx, cols[0].ID, "db"); err != nil {
+		t.Fatalf("RemoveTag: %v", err)
+	}
+	wantErr(t, "RemoveTag(again)", repo.RemoveTag(ctx, cols[0].ID, "db"), biz.ErrNotFound)
+	wantErr(t, "RemoveTag(missing collection)", repo.RemoveTag(ctx, "missing", "go"), biz.ErrNotFound)
+
+	// upserting with tags adds them to the ones already there
+	again := newCollection("https://a/1", "A", base)
+	again.Tags = []string{"db", "web"}
+	saved, err := repo.UpsertCollection(ctx, again, biz.CollectionEvent{})
+	if err != nil || saved.ID != cols[1].ID || !slices.Equal(saved.Tags, []string{"db", "go", "web"}) {
+		t.Errorf("UpsertCollection with tags = %+v, %v; want %s tagged [db go web]", saved, err, cols[1].ID)
+	}
+
+	// trashed collections don't count
+	if err := repo.Delete(ctx, cols[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if c := counts(); c["go"] != 1 || c["db"] != 0 {
+		t.Errorf("ListTags after remove/trash = %v, want go:1 db:0", c)
+	}
+}
+
+func testStreamAndLatest(t *testing.T, repo biz.CollectionRepo) {
+	ctx := context.Background()
+	b := save(t, repo, "B", "https://b/0", "https://b/1")
+	a := save(t, repo, "A", "https://a/0", "https://a/1", "https://a/2")
+	if err := repo.AddTags(ctx, a[0].ID, []string{"go"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(ctx, b[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	stream := func(f biz.CollectionFilter) []string {
+		t.Helper()
+		var got []*biz.Collection
+		err := repo.Stream(ctx, f, func(c *biz.Collection) error {
+			got = append(got, c)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Stream(%+v): %v", f, err)
+		}
+		return ids(got)
+	}
+	if got, want := stream(biz.CollectionFilter{}), ids([]*biz.Collection{a[2], a[1], a[0], b[1]}); !slices.Equal(got, want) {
+		t.Errorf("Stream = %v, want %v", got, want)
+	}
+	start, end := base.Add(time.Minute), base.Add(2*time.Minute)
+	if got, want := stream(biz.CollectionFilter{Origin: "A", Start: &start, End: &end}), ids([]*biz.Collection{a[2], a[1]}); !slices.Equal(got, want) {
+		t.Errorf("Stream(A, range) = %v, want %v", got, want)
+	}
+	if got, want := stream(biz.CollectionFilter{Tags: biz.TagFilter{Tags: []string{"go"}}}), ids(a[:1]); !slices.Equal(got, want) {
+		t.Errorf("Stream(tag go) = %v, want %v", got, want)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := repo.Stream(ctx, biz.CollectionFilter{}, func(*biz.Collection) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("Stream with failing fn = %v after %d calls, want stop after 1", err, calls)
+	}
+
+	latest, err := repo.GetLatest(ctx, biz.CollectionFilter{}, 2)
+	if err != nil {
+		t.Fatalf("GetLatest: %v", err)
+	}
+	if got := ids(latest); len(got) != 2 || got[0] != a[2].ID {
+		t.Errorf("GetLatest = %v, want a/2 first", got)
+	}
+}
+
+func testSearch(t *testing.T, repo biz.CollectionRepo) {
+	ctx := context.Background()
+	a := save(t, repo, "A", "https://a/0", "https://a/1")
+	b := save(t, repo, "B", "https://b/0")
+	a[0].Title = "Gopher weekly"
+	b[0].Title = "gopher digest"
+	a[1].Title = "<script>alert(1)</script>"
+	a[1].Note = "nothing to see"
+	for _, c := range []*biz.Collection{a[0], a[1], b[0]} {
+		if err := repo.Update(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.AddTags(ctx, b[0].ID, []string{"go"}); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(q biz.SearchQuery) []string {
+		t.Helper()
+		res, err := repo.Search(ctx, q, 10)
+		if err != nil {
+			t.Fatalf("Search(%+v): %v", q, err)
+		}
+		var got []string
+		for _, r := range res {
+			got = append(got, r.ID)
+		}
+		slices.Sort(got)
+		return got
+	}
+	want := []string{a[0].ID, b[0].ID}
+	slices.Sort(want)
+	if got := search(biz.SearchQuery{Terms: []string{"GOPHER"}}); !slices.Equal(got, want) {
+		t.Errorf("Search(GOPHER) = %v, want %v", got, want)
+	}
+	if got := search(biz.SearchQuery{Terms: []string{"gopher"}, Origins: []string{"a"}}); !slices.Equal(got, ids(a[:1])) {
+		t.Errorf("Search(gopher origin:a) = %v, want %v", got, ids(a[:1]))
+	}
+	if got := search(biz.SearchQuery{Terms: []string{"gopher"}, Tags: []string{"go"}}); !slices.Equal(got, ids(b)) {
+		t.Errorf("Search(gopher tag:go) = %v, want %v", got, ids(b))
+	}
+	if got := search(biz.SearchQuery{Terms: []string{"100%"}}); len(got) != 0 {
+		t.Errorf("Search(100%%) = %v, want nothing", got)
+	}
+
+	// snippets are HTML: the title's markup is escaped, only <mark> is live
+	res, err := repo.Search(ctx, biz.SearchQuery{Terms: []string{"script"}}, 10)
+	if err != nil || len(res) != 1 || res[0].ID != a[1].ID {
+		t.Fatalf("Search(script) = %v, %v; want %s", res, err, a[1].ID)
+	}
+	if s := res[0].Snippet; strings.Contains(s, "<script") || !strings.Contains(s, "&lt;<mark>script</mark>&gt;") {
+		t.Errorf("Search(script) snippet = %q, want the title escaped with script marked", s)
+	}
+}
+
+func testHistory(t *testing.T, repo biz.CollectionRepo) {
+	ctx := context.Background()
+	col := newCollection("https://example.com/h", "Example", base)
+	first := biz.CollectionEvent{SavedAt: base, SourceHash: "aa", Client: "ios-shortcut", RequestID: "req-1"}
+	second := biz.CollectionEvent{SavedAt: base.Add(time.Hour), SourceHash: "bb", Client: "curl/8.0", RequestID: "req-2"}
+	if _, err := repo.UpsertCollection(ctx, col, first); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := repo.UpsertCollection(ctx, newCollection(col.URL, "Example", base.Add(time.Hour)), second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.SaveCount != 2 || saved.LastSavedAt == nil || !saved.LastSavedAt.Equal(second.SavedAt) {
+		t.Errorf("after two saves SaveCount = %d, LastSavedAt = %v; want 2, %v", saved.SaveCount, saved.LastSavedAt, second.SavedAt)
+	}
+
+	events, err := repo.ListEvents(ctx, col.ID)
+	if err != nil {
+		t.Fatalf("ListEvents: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("ListEvents returned %d events, want 2", len(events))
+	}
+	for i, want := range []biz.CollectionEvent{second, first} {
+		got := events[i]
+		if got.ID == 0 || got.CollectionID != col.ID || !got.SavedAt.Equal(want.SavedAt) ||
+			got.SourceHash != want.SourceHash || got.Client != want.Client || got.RequestID != want.RequestID {
+			t.Errorf("event %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	_, err = repo.ListEvents(ctx, "missing")
+	wantErr(t, "ListEvents(missing)", err, biz.ErrNotFound)
+	if err := repo.Delete(ctx, col.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.ListEvents(ctx, col.ID)
+	wantErr(t, "ListEvents(trashed)", err, biz.ErrNotFound)
+}
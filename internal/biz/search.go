@@ -0,0 +1,84 @@
+package biz
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SearchQuery is a parsed /search query. Terms are matched against URL,
+// title and note; a term containing spaces is a phrase. Origins are ORed,
+// Tags are ANDed.
+type SearchQuery struct {
+	Terms   []string
+	Origins []string
+	Tags    []string
+}
+
+// SearchResult is a matching collection with a highlighted snippet. The
+// snippet is HTML: its text is escaped and matches are wrapped in <mark>.
+// Rank orders results, lower is better.
+type SearchResult struct {
+	*Collection
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+// ParseSearchQuery splits q into words, "quoted phrases" and origin:/tag:
+// filters (whose values may also be quoted).
+func ParseSearchQuery(q string) (SearchQuery, error) {
+	var sq SearchQuery
+	for _, tok := range splitSearchTokens(q) {
+		lower := strings.ToLower(tok)
+		switch {
+		case strings.HasPrefix(lower, "origin:"):
+			if v := strings.Trim(tok[len("origin:"):], `"`); v != "" {
+				sq.Origins = append(sq.Origins, v)
+			}
+		case strings.HasPrefix(lower, "tag:"):
+			if v := strings.Trim(tok[len("tag:"):], `"`); v != "" {
+				sq.Tags = append(sq.Tags, v)
+			}
+		default:
+			if v := strings.TrimSpace(strings.Trim(tok, `"`)); v != "" {
+				sq.Terms = append(sq.Terms, v)
+			}
+		}
+	}
+	if len(sq.Terms) == 0 && len(sq.Origins) == 0 && len(sq.Tags) == 0 {
+		return sq, ErrInvalidArgument.WithMessage("search query can't be empty")
+	}
+	tags, err := NormalizeTags(sq.Tags)
+	if err != nil {
+		return sq, err
+	}
+	sq.Tags = tags
+	return sq, nil
+}
+
+// splitSearchTokens splits on whitespace outside double quotes.
+func splitSearchTokens(s string) []string {
+	var (
+		toks    []string
+		b       strings.Builder
+		inQuote bool
+	)
+	flush := func() {
+		if b.Len() > 0 {
+			toks = append(toks, b.String())
+			b.Reset()
+		}
+	}
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			b.WriteRune(r)
+		case unicode.IsSpace(r) && !inQuote:
+			flush()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	flush()
+	return toks
+}
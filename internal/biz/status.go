@@ -0,0 +1,39 @@
+package biz
+
+// Status tracks where a collection is in the read-later workflow.
+type Status string
+
+const (
+	StatusUnread   Status = "unread"
+	StatusReading  Status = "reading"
+	StatusDone     Status = "done"
+	StatusArchived Status = "archived"
+)
+
+// statusTransitions lists the states reachable from each state.
+var statusTransitions = map[Status][]Status{
+	StatusUnread:   {StatusReading, StatusDone, StatusArchived},
+	StatusReading:  {StatusUnread, StatusDone, StatusArchived},
+	StatusDone:     {StatusUnread, StatusReading, StatusArchived},
+	StatusArchived: {StatusUnread},
+}
+
+// Valid reports whether s is a known status.
+func (s Status) Valid() bool {
+	_, ok := statusTransitions[s]
+	return ok
+}
+
+// CanTransitionTo reports whether moving from s to next is allowed.
+// Staying in the same state is always allowed.
+func (s Status) CanTransitionTo(next Status) bool {
+	if s == next {
+		return true
+	}
+	for _, to := range statusTransitions[s] {
+		if to == next {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package biz
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// maxTagRunes bounds the length of a single tag name.
+const maxTagRunes = 64
+
+// TagCount is a tag together with the number of live collections carrying it.
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// TagFilter restricts list queries to collections carrying the given tags.
+// With MatchAll every tag must be present (AND); otherwise any one is enough (OR).
+// An empty filter matches everything.
+type TagFilter struct {
+	Tags     []string
+	MatchAll bool
+}
+
+// Empty reports whether the filter does not restrict anything.
+func (f TagFilter) Empty() bool {
+	return len(f.Tags) == 0
+}
+
+// NormalizeTags trims, lower-cases and de-duplicates tag names, rejecting
+// empty or overly long ones.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]struct{}, len(tags))
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			return nil, ErrInvalidArgument.WithMessage("tag can't be empty")
+		}
+		if utf8.RuneCountInString(t) > maxTagRunes {
+			return nil, ErrInvalidArgument.WithMessage("tag is too long: " + t)
+		}
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		out = append(out, t)
+	}
+	return out, nil
+}
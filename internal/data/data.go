@@ -2,6 +2,8 @@ package data
 
 import (
 	"context"
+	"errors"
+	"slices"
 	"time"
 
 	"github/heimaolst/collectionbox/internal/biz"
@@ -14,68 +16,344 @@ import (
 type CollectionPO struct {
 	ID        string
 	CreatedAt time.Time
-	URL       string `gorm:"uniqueIndex"`
-	Origin    string
+	// URL holds the canonical form so re-saves with different tracking
+	// parameters hit the same row. 768 characters is as long as MySQL can
+	// index with utf8mb4.
+	URL         string `gorm:"size:768;uniqueIndex"`
+	RawURL      string
+	Origin      string `gorm:"index:idx_collection_content,priority:1"`
+	ContentType string `gorm:"index:idx_collection_content,priority:2"`
+	ContentID   string `gorm:"index:idx_collection_content,priority:3"`
+	Title       string
+	Note        string
+	Status      string `gorm:"index;default:unread"`
+	ReadAt      *time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+	Tags        []TagPO        `gorm:"many2many:collection_tags;joinForeignKey:CollectionID;joinReferences:TagID"`
+	SaveCount   int64          `gorm:"not null;default:0"`
+	LastSavedAt *time.Time
 }
 
 type sqlRepo struct {
 	db *gorm.DB
+	// fts is true when the collection_fts index is available
+	fts bool
 }
 
 func fromBiz(do *biz.Collection) *CollectionPO {
 	return &CollectionPO{
-		ID:        do.ID,
-		CreatedAt: do.CreatedAt,
-		URL:       do.URL,
-		Origin:    do.Origin,
+		ID:          do.ID,
+		CreatedAt:   do.CreatedAt,
+		URL:         do.URL,
+		RawURL:      do.RawURL,
+		Origin:      do.Origin,
+		ContentType: do.ContentType,
+		ContentID:   do.ContentID,
+		Title:       do.Title,
+		Note:        do.Note,
+		Status:      string(do.Status),
+		ReadAt:      do.ReadAt,
 	}
 }
 
 func (po *CollectionPO) toBiz() *biz.Collection {
+	var tags []string
+	for _, t := range po.Tags {
+		tags = append(tags, t.Name)
+	}
 	return &biz.Collection{
-		ID:        po.ID,
-		CreatedAt: po.CreatedAt,
-		URL:       po.URL,
-		Origin:    po.Origin,
+		ID:          po.ID,
+		CreatedAt:   po.CreatedAt,
+		URL:         po.URL,
+		RawURL:      po.RawURL,
+		Origin:      po.Origin,
+		ContentType: po.ContentType,
+		ContentID:   po.ContentID,
+		Title:       po.Title,
+		Note:        po.Note,
+		Tags:        tags,
+		Status:      biz.Status(po.Status),
+		ReadAt:      po.ReadAt,
+		DeletedAt:   deletedAtToBiz(po.DeletedAt),
+		SaveCount:   po.SaveCount,
+		LastSavedAt: po.LastSavedAt,
+	}
+}
+
+func deletedAtToBiz(d gorm.DeletedAt) *time.Time {
+	if !d.Valid {
+		return nil
 	}
+	t := d.Time
+	return &t
 }
 
+// withTags preloads tag names in a stable order.
+func withTags(db *gorm.DB) *gorm.DB {
+	return db.Preload("Tags", func(db *gorm.DB) *gorm.DB {
+		return db.Order("tag_pos.name")
+	})
+}
+
+// wrapQueryError passes biz errors (e.g. a malformed cursor) through, maps
+// unique-constraint violations to ErrConflict and reports everything else as
+// internal. Open enables gorm's error translation, so this works on every
+// backend.
+func wrapQueryError(err error) error {
+	if errors.Is(err, biz.ErrInvalidArgument) || errors.Is(err, biz.ErrConflict) {
+		return err
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return biz.ErrConflict.WithMessage(err.Error())
+	}
+	return biz.ErrInternalError.WithMessage(err.Error())
+}
+
+// NewSQLRepo expects a schema brought up to date by MigrateUp.
 func NewSQLRepo(db *gorm.DB) biz.CollectionRepo {
-	db.AutoMigrate(&CollectionPO{})
-	return &sqlRepo{db: db}
+	return &sqlRepo{db: db, fts: ftsReady(db)}
 }
 
-func (repo *sqlRepo) UpsertCollection(ctx context.Context, c *biz.Collection) (*biz.Collection, error) {
-	po := fromBiz(c)
-	err := repo.db.WithContext(ctx).
-		Clauses(clause.OnConflict{
-			Columns:   []clause.Column{{Name: "url"}},
-			DoUpdates: clause.AssignmentColumns([]string{"created_time"}),
-		}).
-		Clauses(clause.Returning{}).
-		Create(&po).Error
-	return po.toBiz(), err
+// UpsertCollection inserts c, or refreshes the row that already holds its
+// canonical URL, and appends event to its history.
+func (repo *sqlRepo) UpsertCollection(ctx context.Context, c *biz.Collection, event biz.CollectionEvent) (*biz.Collection, error) {
+	results, err := repo.UpsertMany(ctx, []*biz.Collection{c}, event)
+	if err != nil {
+		return nil, err
+	}
+	return results[0].Collection, nil
 }
+
+// UpsertMany writes every row with a single multi-row INSERT ... ON CONFLICT,
+// attaches their tags, and reads them back afterwards so the caller sees their
+// real IDs and tags on every backend (MySQL has no RETURNING). Which URLs were
+// already stored is looked up inside the same transaction, before the insert.
+func (repo *sqlRepo) UpsertMany(ctx context.Context, cols []*biz.Collection, event biz.CollectionEvent) ([]*biz.UpsertResult, error) {
+	if len(cols) == 0 {
+		return []*biz.UpsertResult{}, nil
+	}
+	if event.SavedAt.IsZero() {
+		event.SavedAt = time.Now()
+	}
+	urls := make([]string, 0, len(cols))
+	pos := make([]*CollectionPO, 0, len(cols))
+	for _, c := range cols {
+		if slices.Contains(urls, c.URL) {
+			return nil, biz.ErrInvalidArgument.WithMessage("duplicate url in batch: " + c.URL)
+		}
+		po := fromBiz(c)
+		po.SaveCount, po.LastSavedAt = 1, &event.SavedAt
+		urls = append(urls, c.URL)
+		pos = append(pos, po)
+	}
+
+	var results []*biz.UpsertResult
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 回收站里的也算已存在：重新保存等同于恢复
+		var existing []string
+		if err := tx.Unscoped().Model(&CollectionPO{}).Where("url IN ?", urls).Pluck("url", &existing).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(upsertOnURL(tx)).Create(&pos).Error; err != nil {
+			return err
+		}
+		for i, c := range cols {
+			if len(c.Tags) == 0 {
+				continue
+			}
+			var po CollectionPO
+			if err := tx.Where("url = ?", urls[i]).First(&po).Error; err != nil {
+				return err
+			}
+			if err := attachTags(tx, &po, c.Tags); err != nil {
+				return err
+			}
+		}
+		var saved []*CollectionPO
+		if err := tx.Scopes(withTags).Where("url IN ?", urls).Find(&saved).Error; err != nil {
+			return err
+		}
+		byURL := make(map[string]*CollectionPO, len(saved))
+		for _, po := range saved {
+			byURL[po.URL] = po
+		}
+		events := make([]*CollectionEventPO, 0, len(urls))
+		results = make([]*biz.UpsertResult, 0, len(urls))
+		for _, u := range urls {
+			// MySQL's ON DUPLICATE KEY also fires on an id clash and
+			// updates that other row instead
+			po, ok := byURL[u]
+			if !ok {
+				return biz.ErrConflict.WithMessage("upserted row not found: " + u)
+			}
+			event.CollectionID = po.ID
+			events = append(events, eventFromBiz(&event))
+			results = append(results, &biz.UpsertResult{Collection: po.toBiz(), Created: !slices.Contains(existing, u)})
+		}
+		return tx.Create(&events).Error
+	})
+	if err != nil {
+		return nil, wrapQueryError(err)
+	}
+	return results, nil
+}
+
+// upsertOnURL makes an INSERT refresh the row that already holds the URL.
+func upsertOnURL(tx *gorm.DB) clause.OnConflict {
+	return clause.OnConflict{
+		Columns: []clause.Column{{Name: "url"}},
+		DoUpdates: append(clause.AssignmentColumns([]string{"created_at", "raw_url", "content_type", "content_id", "last_saved_at"}),
+			clause.Assignment{Column: clause.Column{Name: "save_count"}, Value: gorm.Expr("collection_pos.save_count + 1")},
+			// 重复保存时没解析出标题就保留旧标题
+			clause.Assignment{Column: clause.Column{Name: "title"},
+				Value: gorm.Expr("COALESCE(NULLIF(" + excluded(tx, "title") + ", ''), collection_pos.title)")},
+			// 重新保存回收站里的链接等同于恢复
+			clause.Assignment{Column: clause.Column{Name: "deleted_at"}, Value: nil}),
+	}
+}
+
+// excluded refers to the value an upsert tried to write to column.
+func excluded(db *gorm.DB, column string) string {
+	if db.Dialector.Name() == "mysql" {
+		return "VALUES(" + column + ")"
+	}
+	return "excluded." + column
+}
+
 func (repo *sqlRepo) UpdateCollection(ctx context.Context, c *biz.Collection) error {
-	_, err := gorm.G[CollectionPO](repo.db).Where("url = ?", c.URL).Update(ctx, "create_at", time.Now())
+	_, err := gorm.G[CollectionPO](repo.db).Where("url = ?", c.URL).Update(ctx, "created_at", time.Now())
 
 	return err
 }
 
-func (repo *sqlRepo) GetByTimeRange(ctx context.Context, start time.Time, end time.Time, origin string) ([]*biz.Collection, error) {
+func (repo *sqlRepo) GetByTimeRange(ctx context.Context, start time.Time, end time.Time, origin string, tags biz.TagFilter, page biz.PageRequest) (*biz.Page, error) {
 	var pos []*CollectionPO
-	var err error
-	if origin == "" {
-		err = repo.db.WithContext(ctx).
-			Where("create_at BETWEEN ? AND ?", start, end).
-			Find(&pos).Error
-	} else {
-		err = repo.db.WithContext(ctx).
-			Where("create_at BETWEEN ? AND ?", start, end).
-			Where("origin = ?", origin).
-			Find(&pos).Error
+	query := repo.db.WithContext(ctx).
+		Scopes(withTags, tagScope(tags), pageScope(page, false)).
+		Where("created_at BETWEEN ? AND ?", start, end)
+	// origin 为空时返回所有 origin
+	if origin != "" {
+		query = query.Where("origin = ?", origin)
 	}
+	if err := query.Find(&pos).Error; err != nil {
+		return nil, wrapQueryError(err)
+	}
+	return toPage(pos, page.Limit), nil
+}
+
+func (repo *sqlRepo) GetByOrigin(ctx context.Context, origin string, tags biz.TagFilter, page biz.PageRequest) (*biz.Page, error) {
+	var pos []*CollectionPO
+
+	err := repo.db.WithContext(ctx).
+		Scopes(withTags, tagScope(tags), pageScope(page, false)).
+		Where("origin = ?", origin).
+		Find(&pos).Error
+	if err != nil {
+		return nil, wrapQueryError(err)
+	}
+	return toPage(pos, page.Limit), nil
+}
+
+func (repo *sqlRepo) GetByURL(ctx context.Context, url string) (*biz.Collection, error) {
+	var po CollectionPO
+	err := repo.db.WithContext(ctx).Unscoped().Scopes(withTags).Where("url = ?", url).First(&po).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, biz.ErrNotFound.WithMessage("collection " + url)
+	}
+	if err != nil {
+		return nil, biz.ErrInternalError.WithMessage(err.Error())
+	}
+	return po.toBiz(), nil
+}
+
+func (repo *sqlRepo) GetByContentID(ctx context.Context, origin, contentType, contentID string) (*biz.Collection, error) {
+	var po CollectionPO
+	err := repo.db.WithContext(ctx).
+		Scopes(withTags).
+		Where("origin = ? AND content_type = ? AND content_id = ?", origin, contentType, contentID).
+		Order("created_at DESC").
+		First(&po).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, biz.ErrNotFound.WithMessage("content " + contentType + "/" + contentID)
+	}
+	if err != nil {
+		return nil, biz.ErrInternalError.WithMessage(err.Error())
+	}
+	return po.toBiz(), nil
+}
 
+func (repo *sqlRepo) GetByID(ctx context.Context, id string) (*biz.Collection, error) {
+	var po CollectionPO
+	err := repo.db.WithContext(ctx).Scopes(withTags).Where("id = ?", id).First(&po).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, biz.ErrNotFound.WithMessage("collection " + id)
+	}
+	if err != nil {
+		return nil, biz.ErrInternalError.WithMessage(err.Error())
+	}
+	return po.toBiz(), nil
+}
+
+// Update writes the user-editable fields of c back to its row.
+func (repo *sqlRepo) Update(ctx context.Context, c *biz.Collection) error {
+	res := repo.db.WithContext(ctx).Model(&CollectionPO{}).
+		Where("id = ?", c.ID).
+		Updates(map[string]any{"title": c.Title, "origin": c.Origin, "note": c.Note})
+	if res.Error != nil {
+		return biz.ErrInternalError.WithMessage(res.Error.Error())
+	}
+	if res.RowsAffected == 0 {
+		return biz.ErrNotFound.WithMessage("collection " + c.ID)
+	}
+	return nil
+}
+
+// Delete soft-deletes the row; it stays in the trash until restored or purged.
+func (repo *sqlRepo) Delete(ctx context.Context, id string) error {
+	res := repo.db.WithContext(ctx).Where("id = ?", id).Delete(&CollectionPO{})
+	if res.Error != nil {
+		return biz.ErrInternalError.WithMessage(res.Error.Error())
+	}
+	if res.RowsAffected == 0 {
+		return biz.ErrNotFound.WithMessage("collection " + id)
+	}
+	return nil
+}
+
+func (repo *sqlRepo) UpdateStatus(ctx context.Context, id string, status biz.Status, readAt *time.Time) error {
+	res := repo.db.WithContext(ctx).Model(&CollectionPO{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"status": string(status), "read_at": readAt})
+	if res.Error != nil {
+		return biz.ErrInternalError.WithMessage(res.Error.Error())
+	}
+	if res.RowsAffected == 0 {
+		return biz.ErrNotFound.WithMessage("collection " + id)
+	}
+	return nil
+}
+
+func (repo *sqlRepo) GetQueue(ctx context.Context, origin string, page biz.PageRequest) (*biz.Page, error) {
+	var pos []*CollectionPO
+	query := repo.db.WithContext(ctx).
+		Scopes(withTags, pageScope(page, true)).
+		Where("status = ?", string(biz.StatusUnread))
+	if origin != "" {
+		query = query.Where("origin = ?", origin)
+	}
+	if err := query.Find(&pos).Error; err != nil {
+		return nil, wrapQueryError(err)
+	}
+	return toPage(pos, page.Limit), nil
+}
+
+func (repo *sqlRepo) GetLatest(ctx context.Context, filter biz.CollectionFilter, limit int) ([]*biz.Collection, error) {
+	var pos []*CollectionPO
+	err := repo.db.WithContext(ctx).
+		Scopes(withTags, filterScope(filter)).
+		Order("collection_pos.created_at DESC, collection_pos.id DESC").
+		Limit(limit).
+		Find(&pos).Error
 	if err != nil {
 		return nil, biz.ErrInternalError.WithMessage(err.Error())
 	}
@@ -86,11 +364,12 @@ func (repo *sqlRepo) GetByTimeRange(ctx context.Context, start time.Time, end ti
 	return results, nil
 }
 
-func (repo *sqlRepo) GetByOrigin(ctx context.Context, origin string) ([]*biz.Collection, error) {
+func (repo *sqlRepo) ListTrash(ctx context.Context) ([]*biz.Collection, error) {
 	var pos []*CollectionPO
-
-	err := repo.db.WithContext(ctx).
-		Where("origin = ?", origin).
+	err := repo.db.WithContext(ctx).Unscoped().
+		Scopes(withTags).
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC").
 		Find(&pos).Error
 	if err != nil {
 		return nil, biz.ErrInternalError.WithMessage(err.Error())
@@ -102,23 +381,127 @@ func (repo *sqlRepo) GetByOrigin(ctx context.Context, origin string) ([]*biz.Col
 	return results, nil
 }
 
-func (repo *sqlRepo) GetAllGroupedByOrigin(ctx context.Context) (map[string][]*biz.Collection, error) {
+func (repo *sqlRepo) Restore(ctx context.Context, id string) error {
+	res := repo.db.WithContext(ctx).Unscoped().Model(&CollectionPO{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if res.Error != nil {
+		return biz.ErrInternalError.WithMessage(res.Error.Error())
+	}
+	if res.RowsAffected == 0 {
+		return biz.ErrNotFound.WithMessage("trashed collection " + id)
+	}
+	return nil
+}
+
+// PurgeTrash hard-deletes trashed rows together with their tag links and
+// events.
+func (repo *sqlRepo) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		expired := tx.Unscoped().Model(&CollectionPO{}).
+			Select("id").
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", before)
+		if err := tx.Exec("DELETE FROM collection_tags WHERE collection_id IN (?)", expired).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("collection_id IN (?)", expired).Delete(&CollectionEventPO{}).Error; err != nil {
+			return err
+		}
+		res := tx.Unscoped().
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+			Delete(&CollectionPO{})
+		purged = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		return 0, biz.ErrInternalError.WithMessage(err.Error())
+	}
+	return purged, nil
+}
+
+// GetAllGroupedByOrigin ranks rows within each origin and keeps the newest
+// perOrigin (plus one look-ahead row per origin), so memory is bounded by the
+// number of origins rather than the size of the library.
+func (repo *sqlRepo) GetAllGroupedByOrigin(ctx context.Context, tags biz.TagFilter, perOrigin int) (map[string]*biz.Page, error) {
 	var pos []*CollectionPO
 
-	// TODO: I think it will cause OOM in future
-	err := repo.db.WithContext(ctx).Order("origin").Find(&pos).Error
+	ranked := repo.db.Model(&CollectionPO{}).
+		Scopes(tagScope(tags)).
+		Select("collection_pos.*, ROW_NUMBER() OVER (PARTITION BY origin ORDER BY created_at DESC, id DESC) AS rn")
+	err := repo.db.WithContext(ctx).Unscoped().
+		Scopes(withTags).
+		Table("(?) AS collection_pos", ranked).
+		Where("rn <= ?", perOrigin+1).
+		Order("origin, rn").
+		Find(&pos).Error
 	if err != nil {
 		return nil, biz.ErrInternalError.WithMessage(err.Error())
 	}
-	resultMap := make(map[string][]*biz.Collection)
 
+	byOrigin := make(map[string][]*CollectionPO)
 	for _, po := range pos {
-		// 4. 将 PO 转换为 DO
-		do := po.toBiz() // (假设您有这个转换函数)
+		byOrigin[po.Origin] = append(byOrigin[po.Origin], po)
+	}
+	resultMap := make(map[string]*biz.Page, len(byOrigin))
+	for origin, group := range byOrigin {
+		resultMap[origin] = toPage(group, perOrigin)
+	}
+	return resultMap, nil
+}
 
-		// 5. 按 Origin 存入 map
-		resultMap[do.Origin] = append(resultMap[do.Origin], do)
+func (repo *sqlRepo) ListOrigins(ctx context.Context) ([]*biz.OriginCount, error) {
+	var rows []*biz.OriginCount
+	err := repo.db.WithContext(ctx).Model(&CollectionPO{}).
+		Select("origin, COUNT(*) AS count").
+		Group("origin").
+		Order("count DESC, origin").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, biz.ErrInternalError.WithMessage(err.Error())
 	}
+	return rows, nil
+}
 
-	return resultMap, nil
+func (repo *sqlRepo) ListAfter(ctx context.Context, after string, limit int) ([]*biz.Collection, error) {
+	var pos []*CollectionPO
+	err := repo.db.WithContext(ctx).Unscoped().
+		Scopes(withTags).
+		Where("collection_pos.id > ?", after).
+		Order("collection_pos.id").
+		Limit(limit).
+		Find(&pos).Error
+	if err != nil {
+		return nil, biz.ErrInternalError.WithMessage(err.Error())
+	}
+	results := make([]*biz.Collection, 0, len(pos))
+	for _, po := range pos {
+		results = append(results, po.toBiz())
+	}
+	return results, nil
+}
+
+// SetOrigins issues one UPDATE per change; one that matches no row was
+// edited since it was read.
+func (repo *sqlRepo) SetOrigins(ctx context.Context, changes []*biz.OriginChange) ([]*biz.OriginChange, error) {
+	var applied []*biz.OriginChange
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		applied = applied[:0]
+		for _, c := range changes {
+			res := tx.Unscoped().Model(&CollectionPO{}).
+				Where("id = ? AND origin = ?", c.ID, c.From).
+				Update("origin", c.To)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected > 0 {
+				applied = append(applied, c)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wrapQueryError(err)
+	}
+	return applied, nil
 }
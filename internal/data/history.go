@@ -0,0 +1,60 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/biz"
+)
+
+// CollectionEventPO is one row of the save log.
+type CollectionEventPO struct {
+	ID           int64     `gorm:"primaryKey"`
+	CollectionID string    `gorm:"size:64;index:idx_collection_events_collection,priority:1"`
+	SavedAt      time.Time `gorm:"index:idx_collection_events_collection,priority:2"`
+	SourceHash   string    `gorm:"size:64"`
+	Client       string    `gorm:"size:200"`
+	RequestID    string    `gorm:"size:64"`
+}
+
+func (CollectionEventPO) TableName() string { return "collection_events" }
+
+func eventFromBiz(e *biz.CollectionEvent) *CollectionEventPO {
+	return &CollectionEventPO{
+		CollectionID: e.CollectionID,
+		SavedAt:      e.SavedAt,
+		SourceHash:   e.SourceHash,
+		Client:       e.Client,
+		RequestID:    e.RequestID,
+	}
+}
+
+func (po *CollectionEventPO) toBiz() *biz.CollectionEvent {
+	return &biz.CollectionEvent{
+		ID:           po.ID,
+		CollectionID: po.CollectionID,
+		SavedAt:      po.SavedAt,
+		SourceHash:   po.SourceHash,
+		Client:       po.Client,
+		RequestID:    po.RequestID,
+	}
+}
+
+func (repo *sqlRepo) ListEvents(ctx context.Context, id string) ([]*biz.CollectionEvent, error) {
+	if _, err := repo.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	var pos []*CollectionEventPO
+	err := repo.db.WithContext(ctx).
+		Where("collection_id = ?", id).
+		Order("saved_at DESC, id DESC").
+		Find(&pos).Error
+	if err != nil {
+		return nil, wrapQueryError(err)
+	}
+	events := make([]*biz.CollectionEvent, len(pos))
+	for i, po := range pos {
+		events[i] = po.toBiz()
+	}
+	return events, nil
+}
@@ -0,0 +1,547 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/biz"
+)
+
+// memoryRepo is a biz.CollectionRepo held entirely in memory, for tests and
+// throwaway demo instances. It mirrors sqlRepo's semantics, including soft
+// deletes and the tag registry outliving its last collection.
+type memoryRepo struct {
+	mu    sync.RWMutex
+	byID  map[string]*biz.Collection
+	byURL map[string]string
+	// tags records every tag ever added, like tag_pos
+	tags map[string]struct{}
+	// events holds each collection's saves, oldest first
+	events      map[string][]biz.CollectionEvent
+	lastEventID int64
+}
+
+// NewMemoryRepo returns an empty in-memory repository. It is safe for
+// concurrent use; everything is lost when the process exits.
+func NewMemoryRepo() biz.CollectionRepo {
+	return &memoryRepo{
+		byID:   make(map[string]*biz.Collection),
+		byURL:  make(map[string]string),
+		tags:   make(map[string]struct{}),
+		events: make(map[string][]biz.CollectionEvent),
+	}
+}
+
+// clone copies c so callers never share memory with the store.
+func clone(c *biz.Collection) *biz.Collection {
+	out := *c
+	out.Tags = slices.Clone(c.Tags)
+	if c.ReadAt != nil {
+		t := *c.ReadAt
+		out.ReadAt = &t
+	}
+	if c.DeletedAt != nil {
+		t := *c.DeletedAt
+		out.DeletedAt = &t
+	}
+	if c.LastSavedAt != nil {
+		t := *c.LastSavedAt
+		out.LastSavedAt = &t
+	}
+	return &out
+}
+
+// newestFirst orders by (CreatedAt, ID) descending, like pageScope.
+func newestFirst(a, b *biz.Collection) int {
+	if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+		return c
+	}
+	return cmp.Compare(b.ID, a.ID)
+}
+
+func hasTags(c *biz.Collection, f biz.TagFilter) bool {
+	if f.Empty() {
+		return true
+	}
+	matched := 0
+	for _, t := range f.Tags {
+		if slices.Contains(c.Tags, t) {
+			matched++
+		}
+	}
+	if f.MatchAll {
+		return matched == len(f.Tags)
+	}
+	return matched > 0
+}
+
+func matchesFilter(c *biz.Collection, f biz.CollectionFilter) bool {
+	switch {
+	case f.Origin != "" && c.Origin != f.Origin:
+		return false
+	case f.Start != nil && c.CreatedAt.Before(*f.Start):
+		return false
+	case f.End != nil && c.CreatedAt.After(*f.End):
+		return false
+	}
+	return hasTags(c, f.Tags)
+}
+
+// live returns clones of the collections outside the trash that satisfy keep.
+// The caller must hold mu.
+func (repo *memoryRepo) live(keep func(*biz.Collection) bool) []*biz.Collection {
+	var out []*biz.Collection
+	for _, c := range repo.byID {
+		if c.DeletedAt == nil && keep(c) {
+			out = append(out, clone(c))
+		}
+	}
+	return out
+}
+
+// pageOf sorts cols newest first (oldest first when asc) and cuts the page
+// described by p, matching pageScope + toPage.
+func pageOf(cols []*biz.Collection, p biz.PageRequest, asc bool) (*biz.Page, error) {
+	cur, err := biz.DecodeCursor(p.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	order := newestFirst
+	if asc {
+		order = func(a, b *biz.Collection) int { return newestFirst(b, a) }
+	}
+	slices.SortFunc(cols, order)
+	if cur != nil {
+		at := &biz.Collection{CreatedAt: cur.CreatedAt, ID: cur.ID}
+		cols = slices.DeleteFunc(cols, func(c *biz.Collection) bool { return order(c, at) <= 0 })
+	}
+	out := &biz.Page{Items: cols[:min(len(cols), p.Limit)]}
+	if len(cols) > p.Limit {
+		out.NextCursor = biz.CursorAfter(out.Items[p.Limit-1])
+	}
+	return out, nil
+}
+
+func (repo *memoryRepo) UpsertCollection(ctx context.Context, c *biz.Collection, event biz.CollectionEvent) (*biz.Collection, error) {
+	results, err := repo.UpsertMany(ctx, []*biz.Collection{c}, event)
+	if err != nil {
+		return nil, err
+	}
+	return results[0].Collection, nil
+}
+
+func (repo *memoryRepo) UpsertMany(ctx context.Context, cols []*biz.Collection, event biz.CollectionEvent) ([]*biz.UpsertResult, error) {
+	for i, c := range cols {
+		if slices.ContainsFunc(cols[:i], func(o *biz.Collection) bool { return o.URL == c.URL }) {
+			return nil, biz.ErrInvalidArgument.WithMessage("duplicate url in batch: " + c.URL)
+		}
+	}
+	if event.SavedAt.IsZero() {
+		event.SavedAt = time.Now()
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	// validate everything first so a failing batch writes nothing
+	for _, c := range cols {
+		if _, ok := repo.byURL[c.URL]; !ok && repo.byID[c.ID] != nil {
+			return nil, biz.ErrConflict.WithMessage("collection id " + c.ID + " already exists")
+		}
+	}
+	results := make([]*biz.UpsertResult, 0, len(cols))
+	for _, c := range cols {
+		_, existed := repo.byURL[c.URL]
+		saved := repo.upsert(c)
+		repo.addTags(saved, c.Tags)
+		saved.SaveCount++
+		savedAt := event.SavedAt
+		saved.LastSavedAt = &savedAt
+
+		repo.lastEventID++
+		e := event
+		e.ID, e.CollectionID = repo.lastEventID, saved.ID
+		repo.events[saved.ID] = append(repo.events[saved.ID], e)
+		results = append(results, &biz.UpsertResult{Collection: clone(saved), Created: !existed})
+	}
+	return results, nil
+}
+
+// upsert returns the stored collection for c.URL, refreshed from c, or
+// stores a new one. The caller must hold mu.
+func (repo *memoryRepo) upsert(c *biz.Collection) *biz.Collection {
+	if id, ok := repo.byURL[c.URL]; ok {
+		existing := repo.byID[id]
+		existing.CreatedAt = c.CreatedAt
+		existing.RawURL = c.RawURL
+		existing.ContentType = c.ContentType
+		existing.ContentID = c.ContentID
+		if c.Title != "" {
+			existing.Title = c.Title
+		}
+		existing.DeletedAt = nil
+		return existing
+	}
+	saved := clone(c)
+	saved.Tags, saved.DeletedAt = nil, nil
+	saved.SaveCount, saved.LastSavedAt = 0, nil
+	if saved.Status == "" {
+		saved.Status = biz.StatusUnread
+	}
+	repo.byID[saved.ID] = saved
+	repo.byURL[saved.URL] = saved.ID
+	return saved
+}
+
+func (repo *memoryRepo) UpdateCollection(ctx context.Context, c *biz.Collection) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if id, ok := repo.byURL[c.URL]; ok {
+		repo.byID[id].CreatedAt = time.Now()
+	}
+	return nil
+}
+
+func (repo *memoryRepo) GetByTimeRange(ctx context.Context, start time.Time, end time.Time, origin string, tags biz.TagFilter, p biz.PageRequest) (*biz.Page, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	f := biz.CollectionFilter{Origin: origin, Start: &start, End: &end, Tags: tags}
+	return pageOf(repo.live(func(c *biz.Collection) bool { return matchesFilter(c, f) }), p, false)
+}
+
+func (repo *memoryRepo) GetByOrigin(ctx context.Context, origin string, tags biz.TagFilter, p biz.PageRequest) (*biz.Page, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	return pageOf(repo.live(func(c *biz.Collection) bool { return c.Origin == origin && hasTags(c, tags) }), p, false)
+}
+
+func (repo *memoryRepo) GetByURL(ctx context.Context, url string) (*biz.Collection, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	if id, ok := repo.byURL[url]; ok {
+		return clone(repo.byID[id]), nil
+	}
+	return nil, biz.ErrNotFound.WithMessage("collection " + url)
+}
+
+func (repo *memoryRepo) GetByContentID(ctx context.Context, origin, contentType, contentID string) (*biz.Collection, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	cols := repo.live(func(c *biz.Collection) bool {
+		return c.Origin == origin && c.ContentType == contentType && c.ContentID == contentID
+	})
+	if len(cols) == 0 {
+		return nil, biz.ErrNotFound.WithMessage("content " + contentType + "/" + contentID)
+	}
+	return slices.MinFunc(cols, newestFirst), nil
+}
+
+func (repo *memoryRepo) GetAllGroupedByOrigin(ctx context.Context, tags biz.TagFilter, perOrigin int) (map[string]*biz.Page, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	byOrigin := make(map[string][]*biz.Collection)
+	for _, c := range repo.live(func(c *biz.Collection) bool { return hasTags(c, tags) }) {
+		byOrigin[c.Origin] = append(byOrigin[c.Origin], c)
+	}
+	result := make(map[string]*biz.Page, len(byOrigin))
+	for origin, group := range byOrigin {
+		p, err := pageOf(group, biz.PageRequest{Limit: perOrigin}, false)
+		if err != nil {
+			return nil, err
+		}
+		result[origin] = p
+	}
+	return result, nil
+}
+
+func (repo *memoryRepo) GetByID(ctx context.Context, id string) (*biz.Collection, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	c, err := repo.liveByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return clone(c), nil
+}
+
+// liveByID returns the stored (not cloned) collection. The caller must hold mu.
+func (repo *memoryRepo) liveByID(id string) (*biz.Collection, error) {
+	c, ok := repo.byID[id]
+	if !ok || c.DeletedAt != nil {
+		return nil, biz.ErrNotFound.WithMessage("collection " + id)
+	}
+	return c, nil
+}
+
+func (repo *memoryRepo) Update(ctx context.Context, c *biz.Collection) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	stored, err := repo.liveByID(c.ID)
+	if err != nil {
+		return err
+	}
+	stored.Title, stored.Origin, stored.Note = c.Title, c.Origin, c.Note
+	return nil
+}
+
+func (repo *memoryRepo) Delete(ctx context.Context, id string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	stored, err := repo.liveByID(id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	stored.DeletedAt = &now
+	return nil
+}
+
+func (repo *memoryRepo) ListTrash(ctx context.Context) ([]*biz.Collection, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	trash := make([]*biz.Collection, 0)
+	for _, c := range repo.byID {
+		if c.DeletedAt != nil {
+			trash = append(trash, clone(c))
+		}
+	}
+	slices.SortFunc(trash, func(a, b *biz.Collection) int { return b.DeletedAt.Compare(*a.DeletedAt) })
+	return trash, nil
+}
+
+func (repo *memoryRepo) Restore(ctx context.Context, id string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	c, ok := repo.byID[id]
+	if !ok || c.DeletedAt == nil {
+		return biz.ErrNotFound.WithMessage("trashed collection " + id)
+	}
+	c.DeletedAt = nil
+	return nil
+}
+
+func (repo *memoryRepo) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	var purged int64
+	for id, c := range repo.byID {
+		if c.DeletedAt != nil && c.DeletedAt.Before(before) {
+			delete(repo.byID, id)
+			delete(repo.byURL, c.URL)
+			delete(repo.events, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (repo *memoryRepo) UpdateStatus(ctx context.Context, id string, status biz.Status, readAt *time.Time) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	stored, err := repo.liveByID(id)
+	if err != nil {
+		return err
+	}
+	stored.Status = status
+	stored.ReadAt = nil
+	if readAt != nil {
+		t := *readAt
+		stored.ReadAt = &t
+	}
+	return nil
+}
+
+func (repo *memoryRepo) GetQueue(ctx context.Context, origin string, p biz.PageRequest) (*biz.Page, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	return pageOf(repo.live(func(c *biz.Collection) bool {
+		return c.Status == biz.StatusUnread && (origin == "" || c.Origin == origin)
+	}), p, true)
+}
+
+func (repo *memoryRepo) GetLatest(ctx context.Context, filter biz.CollectionFilter, limit int) ([]*biz.Collection, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	cols := repo.live(func(c *biz.Collection) bool { return matchesFilter(c, filter) })
+	slices.SortFunc(cols, newestFirst)
+	return cols[:min(len(cols), limit)], nil
+}
+
+// Stream snapshots the matching collections and calls fn without holding the
+// lock, so fn may call back into the repo.
+func (repo *memoryRepo) Stream(ctx context.Context, filter biz.CollectionFilter, fn func(*biz.Collection) error) error {
+	repo.mu.RLock()
+	cols := repo.live(func(c *biz.Collection) bool { return matchesFilter(c, filter) })
+	repo.mu.RUnlock()
+	slices.SortFunc(cols, func(a, b *biz.Collection) int {
+		return cmp.Or(cmp.Compare(a.Origin, b.Origin), newestFirst(a, b))
+	})
+	for _, c := range cols {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Search behaves like sqlRepo's LIKE fallback.
+func (repo *memoryRepo) Search(ctx context.Context, q biz.SearchQuery, limit int) ([]*biz.SearchResult, error) {
+	repo.mu.RLock()
+	cols := repo.live(func(c *biz.Collection) bool {
+		if len(q.Origins) > 0 && !slices.ContainsFunc(q.Origins, func(o string) bool { return strings.EqualFold(o, c.Origin) }) {
+			return false
+		}
+		if !hasTags(c, biz.TagFilter{Tags: q.Tags, MatchAll: true}) {
+			return false
+		}
+		haystack := strings.ToLower(c.URL + "\x00" + c.Title + "\x00" + c.Note)
+		for _, t := range q.Terms {
+			if !strings.Contains(haystack, strings.ToLower(t)) {
+				return false
+			}
+		}
+		return true
+	})
+	repo.mu.RUnlock()
+
+	slices.SortFunc(cols, newestFirst)
+	cols = cols[:min(len(cols), limit)]
+	results := make([]*biz.SearchResult, 0, len(cols))
+	for _, c := range cols {
+		snippet, hits := likeSnippet(fromBiz(c), q.Terms)
+		results = append(results, &biz.SearchResult{Collection: c, Snippet: snippet, Rank: -float64(hits)})
+	}
+	slices.SortStableFunc(results, func(a, b *biz.SearchResult) int { return cmp.Compare(a.Rank, b.Rank) })
+	return results, nil
+}
+
+func (repo *memoryRepo) AddTags(ctx context.Context, id string, tags []string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	stored, err := repo.liveByID(id)
+	if err != nil {
+		return err
+	}
+	repo.addTags(stored, tags)
+	return nil
+}
+
+// addTags links tags to stored. The caller must hold mu.
+func (repo *memoryRepo) addTags(stored *biz.Collection, tags []string) {
+	for _, t := range tags {
+		repo.tags[t] = struct{}{}
+		if !slices.Contains(stored.Tags, t) {
+			stored.Tags = append(stored.Tags, t)
+		}
+	}
+	slices.Sort(stored.Tags)
+}
+
+func (repo *memoryRepo) RemoveTag(ctx context.Context, id string, tag string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	stored, err := repo.liveByID(id)
+	if err != nil {
+		return err
+	}
+	i := slices.Index(stored.Tags, tag)
+	if i < 0 {
+		return biz.ErrNotFound.WithMessage("tag " + tag + " on collection " + id)
+	}
+	stored.Tags = slices.Delete(stored.Tags, i, i+1)
+	return nil
+}
+
+func (repo *memoryRepo) ListTags(ctx context.Context) ([]*biz.TagCount, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	counts := make(map[string]int64, len(repo.tags))
+	for t := range repo.tags {
+		counts[t] = 0
+	}
+	for _, c := range repo.byID {
+		if c.DeletedAt != nil {
+			continue
+		}
+		for _, t := range c.Tags {
+			counts[t]++
+		}
+	}
+	out := make([]*biz.TagCount, 0, len(counts))
+	for name, n := range counts {
+		out = append(out, &biz.TagCount{Name: name, Count: n})
+	}
+	slices.SortFunc(out, func(a, b *biz.TagCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Name, b.Name))
+	})
+	return out, nil
+}
+
+func (repo *memoryRepo) ListEvents(ctx context.Context, id string) ([]*biz.CollectionEvent, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	if _, err := repo.liveByID(id); err != nil {
+		return nil, err
+	}
+	saved := repo.events[id]
+	events := make([]*biz.CollectionEvent, len(saved))
+	for i, e := range saved {
+		events[len(saved)-1-i] = &e
+	}
+	return events, nil
+}
+
+func (repo *memoryRepo) ListOrigins(ctx context.Context) ([]*biz.OriginCount, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	counts := make(map[string]int64)
+	for _, c := range repo.byID {
+		if c.DeletedAt == nil {
+			counts[c.Origin]++
+		}
+	}
+	out := make([]*biz.OriginCount, 0, len(counts))
+	for origin, n := range counts {
+		out = append(out, &biz.OriginCount{Origin: origin, Count: n})
+	}
+	slices.SortFunc(out, func(a, b *biz.OriginCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Origin, b.Origin))
+	})
+	return out, nil
+}
+
+func (repo *memoryRepo) ListAfter(ctx context.Context, after string, limit int) ([]*biz.Collection, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	ids := make([]string, 0, len(repo.byID))
+	for id := range repo.byID {
+		if id > after {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	ids = ids[:min(limit, len(ids))]
+	out := make([]*biz.Collection, len(ids))
+	for i, id := range ids {
+		out[i] = clone(repo.byID[id])
+	}
+	return out, nil
+}
+
+func (repo *memoryRepo) SetOrigins(ctx context.Context, changes []*biz.OriginChange) ([]*biz.OriginChange, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	var applied []*biz.OriginChange
+	for _, ch := range changes {
+		if c, ok := repo.byID[ch.ID]; ok && c.Origin == ch.From {
+			c.Origin = ch.To
+			applied = append(applied, ch)
+		}
+	}
+	return applied, nil
+}
@@ -0,0 +1,260 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/data/schemav1"
+	"github/heimaolst/collectionbox/internal/data/schemav2"
+	"github/heimaolst/collectionbox/internal/data/schemav3"
+	"github/heimaolst/collectionbox/internal/logx"
+
+	"gorm.io/gorm"
+)
+
+// migration is one step of the schema history. up and down run inside a
+// transaction (MySQL commits DDL implicitly, so a failed step there may need
+// manual cleanup). Steps must not use the live PO structs: those follow the
+// latest schema, while a step has to produce the same result forever, so
+// each version that needs structs freezes them in its own package.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *gorm.DB) error
+	down    func(tx *gorm.DB) error
+}
+
+// migrations is the ordered schema history; append only.
+var migrations = []migration{
+	{1, "baseline", upBaseline, downBaseline},
+	{2, "collection_events", upCollectionEvents, downCollectionEvents},
+	{3, "origins", upOrigins, downOrigins},
+	{4, "collection_fts", upCollectionFTS, downCollectionFTS},
+}
+
+// LatestSchemaVersion is the schema version this binary expects.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// schemaMigrationPO records an applied migration.
+type schemaMigrationPO struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigrationPO) TableName() string { return "schema_migrations" }
+
+// ErrSchemaTooNew means the database was migrated by a newer binary.
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+// SchemaVersion returns the highest applied migration, 0 for a fresh database.
+func SchemaVersion(ctx context.Context, db *gorm.DB) (int, error) {
+	db = db.WithContext(ctx)
+	if !db.Migrator().HasTable(&schemaMigrationPO{}) {
+		return 0, nil
+	}
+	var version int
+	err := db.Model(&schemaMigrationPO{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// ErrSchemaPending means the database lacks migrations this binary needs.
+var ErrSchemaPending = errors.New("database schema has pending migrations")
+
+// CheckSchema reports, without changing anything, whether db is at exactly
+// LatestSchemaVersion: ErrSchemaTooNew when a newer binary migrated it,
+// ErrSchemaPending when it needs MigrateUp.
+func CheckSchema(ctx context.Context, db *gorm.DB) error {
+	current, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	switch latest := LatestSchemaVersion(); {
+	case current > latest:
+		return fmt.Errorf("%w: database is at v%d, this binary knows up to v%d", ErrSchemaTooNew, current, latest)
+	case current < latest:
+		return fmt.Errorf("%w: database is at v%d, this binary needs v%d", ErrSchemaPending, current, latest)
+	}
+	return nil
+}
+
+// MigrateUp applies every pending migration. It refuses to touch a schema
+// newer than LatestSchemaVersion, so an old binary can't corrupt it.
+func MigrateUp(ctx context.Context, db *gorm.DB) error {
+	return MigrateTo(ctx, db, LatestSchemaVersion())
+}
+
+// MigrateTo moves the schema up or down to target; 0 removes everything.
+func MigrateTo(ctx context.Context, db *gorm.DB, target int) error {
+	if target < 0 || target > LatestSchemaVersion() {
+		return fmt.Errorf("unknown schema version %d (latest is %d)", target, LatestSchemaVersion())
+	}
+	db = db.WithContext(ctx)
+	if err := db.Migrator().AutoMigrate(&schemaMigrationPO{}); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	current, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if current > LatestSchemaVersion() {
+		return fmt.Errorf("%w: database is at v%d, this binary knows up to v%d", ErrSchemaTooNew, current, LatestSchemaVersion())
+	}
+
+	log := logx.FromContext(ctx)
+	for _, m := range migrations {
+		if m.version <= current || m.version > target {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigrationPO{Version: m.version, Name: m.name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migrate up to v%d (%s): %w", m.version, m.name, err)
+		}
+		log.Info("schema migrated up", "version", m.version, "name", m.name)
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.version > current || m.version <= target {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigrationPO{}, "version = ?", m.version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migrate down from v%d (%s): %w", m.version, m.name, err)
+		}
+		log.Info("schema migrated down", "version", m.version, "name", m.name)
+	}
+	return nil
+}
+
+// upBaseline creates the v1 tables. AutoMigrate only adds what is missing,
+// so databases created before versioning are adopted as they are.
+func upBaseline(tx *gorm.DB) error {
+	return tx.Migrator().AutoMigrate(&schemav1.CollectionPO{}, &schemav1.TagPO{}, &schemav1.ShortLinkPO{})
+}
+
+func downBaseline(tx *gorm.DB) error {
+	return tx.Migrator().DropTable("collection_tags", &schemav1.CollectionPO{}, &schemav1.TagPO{}, &schemav1.ShortLinkPO{})
+}
+
+// upCollectionEvents adds the save log. Saves before v2 left no trace, so
+// every existing row counts as saved once, at its CreatedAt, with a matching
+// event so its history agrees with SaveCount.
+func upCollectionEvents(tx *gorm.DB) error {
+	m := tx.Migrator()
+	for _, col := range []string{"SaveCount", "LastSavedAt"} {
+		if m.HasColumn(&schemav2.CollectionPO{}, col) {
+			continue
+		}
+		if err := m.AddColumn(&schemav2.CollectionPO{}, col); err != nil {
+			return err
+		}
+	}
+	if err := m.AutoMigrate(&schemav2.CollectionEventPO{}); err != nil {
+		return err
+	}
+	// save_count = 0 picks the rows not backfilled yet, so insert before updating
+	err := tx.Exec("INSERT INTO collection_events (collection_id, saved_at, source_hash, client, request_id) " +
+		"SELECT id, created_at, '', '', '' FROM collection_pos WHERE save_count = 0").Error
+	if err != nil {
+		return err
+	}
+	return tx.Exec("UPDATE collection_pos SET save_count = 1, last_saved_at = created_at WHERE save_count = 0").Error
+}
+
+// downCollectionEvents drops the columns with plain ALTER TABLE: gorm's
+// SQLite DropColumn rebuilds the table and loses its indexes.
+func downCollectionEvents(tx *gorm.DB) error {
+	if err := tx.Migrator().DropTable(&schemav2.CollectionEventPO{}); err != nil {
+		return err
+	}
+	for _, col := range []string{"save_count", "last_saved_at"} {
+		if err := tx.Exec("ALTER TABLE collection_pos DROP COLUMN " + col).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upOrigins creates the origins table empty, along with the record of seeded
+// hosts; the server seeds both from origin.json on start (see SeedOrigins).
+func upOrigins(tx *gorm.DB) error {
+	return tx.Migrator().AutoMigrate(&schemav3.OriginPO{}, &schemav3.OriginSeedPO{})
+}
+
+func downOrigins(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&schemav3.OriginPO{}, &schemav3.OriginSeedPO{})
+}
+
+// collection_fts mirrors url/title/note of collection_pos and is kept in sync
+// by triggers. The trigram tokenizer gives substring matching, which is what
+// Chinese text needs: unicode61 would treat a whole CJK run as one token.
+var ftsSchema = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS collection_fts USING fts5(id UNINDEXED, url, title, note, tokenize = 'trigram')`,
+	`CREATE TRIGGER IF NOT EXISTS collection_fts_ai AFTER INSERT ON collection_pos BEGIN
+		INSERT INTO collection_fts(id, url, title, note) VALUES (new.id, new.url, new.title, new.note);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS collection_fts_au AFTER UPDATE OF url, title, note ON collection_pos BEGIN
+		UPDATE collection_fts SET url = new.url, title = new.title, note = new.note WHERE id = old.id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS collection_fts_ad AFTER DELETE ON collection_pos BEGIN
+		DELETE FROM collection_fts WHERE id = old.id;
+	END`,
+}
+
+// upCollectionFTS adds the full-text index behind Search. It only exists on
+// SQLite built with -tags sqlite_fts5; elsewhere the step records nothing to
+// do and Search uses LIKE. Databases from before versioning may already have
+// the index, in which case it is kept rather than filled twice.
+func upCollectionFTS(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "sqlite" {
+		return nil
+	}
+	if !sqliteHasFTS5(tx) {
+		logx.FromContext(tx.Statement.Context).Warn("fts5 unavailable, search falls back to LIKE (build with -tags sqlite_fts5)")
+		return nil
+	}
+	var existing int64
+	if err := tx.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'collection_fts'").Scan(&existing).Error; err != nil {
+		return err
+	}
+	for _, stmt := range ftsSchema {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	if existing > 0 {
+		return nil
+	}
+	return tx.Exec("INSERT INTO collection_fts(id, url, title, note) SELECT id, url, title, note FROM collection_pos").Error
+}
+
+func downCollectionFTS(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "sqlite" {
+		return nil
+	}
+	for _, stmt := range []string{
+		"DROP TRIGGER IF EXISTS collection_fts_ai",
+		"DROP TRIGGER IF EXISTS collection_fts_au",
+		"DROP TRIGGER IF EXISTS collection_fts_ad",
+		"DROP TABLE IF EXISTS collection_fts",
+	} {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
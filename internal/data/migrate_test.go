@@ -0,0 +1,211 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/data/schemav1"
+	"github/heimaolst/collectionbox/internal/data/schemav2"
+	"github/heimaolst/collectionbox/internal/data/schemav3"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+func TestMigrateDownAndUp(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	if v, err := SchemaVersion(ctx, db); err != nil || v != LatestSchemaVersion() {
+		t.Fatalf("SchemaVersion = %d, %v; want %d", v, err, LatestSchemaVersion())
+	}
+
+	// stepping back one version keeps the indexes of the tables that stay
+	if err := MigrateTo(ctx, db, 1); err != nil {
+		t.Fatalf("MigrateTo(1): %v", err)
+	}
+	if db.Migrator().HasTable(&CollectionEventPO{}) || db.Migrator().HasColumn(&CollectionPO{}, "SaveCount") {
+		t.Error("v2 schema survived migrating to 1")
+	}
+	if db.Migrator().HasTable(&OriginPO{}) || db.Migrator().HasTable(&OriginSeedPO{}) {
+		t.Error("origins survived migrating to 1")
+	}
+	if !db.Migrator().HasIndex(&CollectionPO{}, "idx_collection_pos_url") {
+		t.Error("unique url index lost migrating to 1")
+	}
+
+	if err := MigrateTo(ctx, db, 0); err != nil {
+		t.Fatalf("MigrateTo(0): %v", err)
+	}
+	if db.Migrator().HasTable(&CollectionPO{}) {
+		t.Error("collection_pos survived migrating to 0")
+	}
+	if v, _ := SchemaVersion(ctx, db); v != 0 {
+		t.Errorf("SchemaVersion after down = %d, want 0", v)
+	}
+
+	if err := MigrateUp(ctx, db); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	// running it again is a no-op
+	if err := MigrateUp(ctx, db); err != nil {
+		t.Fatalf("MigrateUp again: %v", err)
+	}
+	if !db.Migrator().HasTable(&CollectionPO{}) || !db.Migrator().HasTable("collection_tags") {
+		t.Error("tables missing after MigrateUp")
+	}
+}
+
+func TestMigrateAdoptsAutoMigratedDatabase(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open("sqlite://"+filepath.Join(t.TempDir(), "old.db"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// what NewSQLRepo did before migrations were versioned
+	if err := db.AutoMigrate(&schemav1.CollectionPO{}, &schemav1.TagPO{}, &schemav1.ShortLinkPO{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&schemav1.CollectionPO{ID: "1", URL: "https://a/1", Origin: "A", CreatedAt: time.Now()}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateUp(ctx, db); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	col, err := NewSQLRepo(db).GetByID(ctx, "1")
+	if err != nil {
+		t.Fatalf("existing row lost: %v", err)
+	}
+	// v2 counts rows saved before the event log existed as saved once
+	if col.SaveCount != 1 || col.LastSavedAt == nil || !col.LastSavedAt.Equal(col.CreatedAt) {
+		t.Errorf("backfilled SaveCount = %d, LastSavedAt = %v; want 1, %v", col.SaveCount, col.LastSavedAt, col.CreatedAt)
+	}
+	// and gives it the event that save would have logged
+	events, err := NewSQLRepo(db).ListEvents(ctx, "1")
+	if err != nil || len(events) != 1 || !events[0].SavedAt.Equal(col.CreatedAt) || events[0].SourceHash != "" || events[0].Client != "" {
+		t.Errorf("backfilled events = %+v, %v; want one saved at %v", events, err, col.CreatedAt)
+	}
+}
+
+// With -tags sqlite_fts5 v4 builds the index over rows saved before it;
+// without it v4 applies as a no-op and search uses LIKE.
+func TestMigrateCollectionFTS(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	if err := MigrateTo(ctx, db, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&schemav1.CollectionPO{ID: "1", URL: "https://a/1", Origin: "A", Title: "关于 gorm 软删除的回答", CreatedAt: time.Now()}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateUp(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	fts := sqliteHasFTS5(db)
+	if got := db.Migrator().HasTable("collection_fts"); got != fts {
+		t.Fatalf("collection_fts exists = %v, want %v", got, fts)
+	}
+	if repo := NewSQLRepo(db).(*sqlRepo); repo.fts != fts {
+		t.Errorf("repo.fts = %v, want %v", repo.fts, fts)
+	}
+	if fts {
+		var n int64
+		db.Raw("SELECT COUNT(*) FROM collection_fts WHERE collection_fts MATCH ?", `"软删除"`).Scan(&n)
+		if n != 1 {
+			t.Errorf("FTS matches for the row saved before v4 = %d, want 1", n)
+		}
+	}
+
+	if err := MigrateTo(ctx, db, 3); err != nil {
+		t.Fatalf("MigrateTo(3): %v", err)
+	}
+	if db.Migrator().HasTable("collection_fts") {
+		t.Error("collection_fts survived migrating to 3")
+	}
+	// the triggers went with it
+	if err := db.Create(&schemav1.CollectionPO{ID: "2", URL: "https://a/2", Origin: "A", CreatedAt: time.Now()}).Error; err != nil {
+		t.Errorf("insert after dropping the index: %v", err)
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open("sqlite://"+filepath.Join(t.TempDir(), "check.db"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSchema(ctx, db); !errors.Is(err, ErrSchemaPending) {
+		t.Errorf("fresh database: CheckSchema = %v, want ErrSchemaPending", err)
+	}
+	if db.Migrator().HasTable(&schemaMigrationPO{}) {
+		t.Error("CheckSchema created schema_migrations")
+	}
+	if err := MigrateTo(ctx, db, LatestSchemaVersion()-1); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSchema(ctx, db); !errors.Is(err, ErrSchemaPending) {
+		t.Errorf("one behind: CheckSchema = %v, want ErrSchemaPending", err)
+	}
+	if err := MigrateUp(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSchema(ctx, db); err != nil {
+		t.Errorf("up to date: CheckSchema = %v", err)
+	}
+	newer := schemaMigrationPO{Version: LatestSchemaVersion() + 1, Name: "from the future", AppliedAt: time.Now()}
+	if err := db.Create(&newer).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSchema(ctx, db); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("newer: CheckSchema = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	newer := schemaMigrationPO{Version: LatestSchemaVersion() + 1, Name: "from the future", AppliedAt: time.Now()}
+	if err := db.Create(&newer).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateUp(ctx, db); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("MigrateUp = %v, want ErrSchemaTooNew", err)
+	}
+	if err := MigrateTo(ctx, db, 0); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("MigrateTo(0) = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+// MySQL can't index an unsized string, which gorm maps to longtext; catch
+// that here since the MySQL contract only runs when TEST_MYSQL_DSN is set.
+func TestMySQLIndexedStringsHaveSize(t *testing.T) {
+	dialector := mysql.Dialector{Config: &mysql.Config{}}
+	var cache sync.Map
+	models := []any{
+		&schemav1.CollectionPO{}, &schemav1.TagPO{}, &schemav1.ShortLinkPO{},
+		&schemav2.CollectionEventPO{}, &schemav3.OriginPO{}, &schemav3.OriginSeedPO{},
+		&CollectionPO{}, &TagPO{}, &ShortLinkPO{}, &CollectionEventPO{}, &OriginPO{}, &OriginSeedPO{},
+	}
+	for _, model := range models {
+		s, err := schema.Parse(model, &cache, schema.NamingStrategy{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, idx := range s.ParseIndexes() {
+			for _, opt := range idx.Fields {
+				if opt.DataType != schema.String {
+					continue
+				}
+				if typ := dialector.DataTypeOf(opt.Field); strings.HasSuffix(typ, "text") {
+					t.Errorf("%T.%s is indexed as %s on MySQL; give it a size", model, opt.Name, typ)
+				}
+			}
+		}
+	}
+}
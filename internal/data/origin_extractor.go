@@ -3,11 +3,14 @@ package data
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github/heimaolst/collectionbox/internal/biz"
+	"github/heimaolst/collectionbox/internal/logx"
 	"net/url"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
 
 	"golang.org/x/net/publicsuffix"
@@ -16,10 +19,88 @@ import (
 // 1. 定义 JSON 结构体 (可以放在 data 层)
 type originConfig struct {
 	Supports []string `json:"support"`
-	Items    []struct {
-		Host   string `json:"host"`
-		Origin string `json:"origin"`
-	} `json:"items"`
+	// ShortLinks 是需要先展开再映射 origin 的短链 host，如 b23.tv
+	ShortLinks []string `json:"short_links"`
+	// Canonical 是所有 origin 共用的默认规范化规则
+	Canonical canonicalRule `json:"canonical"`
+	// Unmapped 决定 items 里没有的 host 怎么处理，缺省时拒绝
+	Unmapped unmappedConfig `json:"unmapped"`
+	Items    []originItem   `json:"items"`
+}
+
+// originItem 是一个 origin 的配置；数据库里的 origins 表存的也是这个格式
+type originItem struct {
+	// Host 是 host 模式：精确 host、*. 通配子域名，或者再加上路径前缀，见 hostPattern
+	Host      string         `json:"host"`
+	Origin    string         `json:"origin"`
+	Icon      string         `json:"icon,omitempty"`
+	Canonical *canonicalRule `json:"canonical,omitempty"`
+	// ContentIDs 按顺序尝试，第一个匹配的规则生效
+	ContentIDs []contentIDRule `json:"content_ids,omitempty"`
+	// ShareTexts 从分享文案中提取标题，同样按顺序尝试
+	ShareTexts []shareTextRule `json:"share_text,omitempty"`
+
+	pattern hostPattern
+}
+
+// validate parses the host pattern, rewriting Host to its canonical
+// spelling, and checks the item's rules and compiles their patterns.
+func (v *originItem) validate() error {
+	pattern, key, err := parseHostPattern(v.Host)
+	if err != nil {
+		return err
+	}
+	v.pattern, v.Host = pattern, key
+	if v.Canonical != nil {
+		if err := v.Canonical.validate(); err != nil {
+			return fmt.Errorf("invalid canonical rule for %s: %w", v.Host, err)
+		}
+	}
+	for i := range v.ContentIDs {
+		if err := v.ContentIDs[i].compile(); err != nil {
+			return fmt.Errorf("invalid content id rule for %s: %w", v.Host, err)
+		}
+	}
+	for i := range v.ShareTexts {
+		if err := v.ShareTexts[i].compile(); err != nil {
+			return fmt.Errorf("invalid share text rule for %s: %w", v.Host, err)
+		}
+	}
+	return nil
+}
+
+// unmappedPolicy decides what happens to a link whose host has no items entry.
+type unmappedPolicy string
+
+const (
+	// unmappedReject rejects it as an unsupported origin.
+	unmappedReject unmappedPolicy = "reject"
+	// unmappedFallback files it under one catch-all origin.
+	unmappedFallback unmappedPolicy = "fallback"
+	// unmappedDerive uses the host's eTLD+1 (e.g. github.com) as its origin.
+	unmappedDerive unmappedPolicy = "derive"
+)
+
+type unmappedConfig struct {
+	Policy unmappedPolicy `json:"policy"`
+	// FallbackOrigin names the catch-all origin; defaults to "Other".
+	FallbackOrigin string `json:"fallback_origin,omitempty"`
+}
+
+// normalize fills in defaults and rejects unknown policies.
+func (c *unmappedConfig) normalize() error {
+	switch c.Policy {
+	case "":
+		c.Policy = unmappedReject
+	case unmappedReject, unmappedDerive:
+	case unmappedFallback:
+		if c.FallbackOrigin == "" {
+			c.FallbackOrigin = "Other"
+		}
+	default:
+		return fmt.Errorf("unknown policy %q: use reject, fallback or derive", c.Policy)
+	}
+	return nil
 }
 
 // httpURLRegex: 匹配以 http/https 开头的 URL，遇到空白或常见分隔符就停止。
@@ -31,105 +112,152 @@ var bareURLRegex = regexp.MustCompile(`\b[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}[^\s"'<>()]
 
 // 2. 定义实现
 type jsonOriginExtractor struct {
+	// originMap、rules、contentIDs、shareTexts 都以规范化后的 host 模式为 key，
+	// matcher 负责为链接找到最具体的那个模式
 	originMap map[string]string
+	matcher   hostMatcher
+	// rules 缺省时使用 defaultRule
+	rules       map[string]canonicalRule
+	defaultRule canonicalRule
+	contentIDs  map[string][]contentIDRule
+	shareTexts  map[string][]shareTextRule
+	shortHosts  map[string]struct{}
+	resolver    ShortLinkResolver
+	unmapped    unmappedConfig
+}
+
+// ExtractorOption configures optional jsonOriginExtractor behaviour.
+type ExtractorOption func(*jsonOriginExtractor)
+
+// WithShortLinkResolver expands links on the configured short_links hosts
+// before origin mapping. Without it such links are rejected as unsupported.
+func WithShortLinkResolver(r ShortLinkResolver) ExtractorOption {
+	return func(e *jsonOriginExtractor) {
+		e.resolver = r
+	}
 }
 
 // urlOrigin was a local helper; use biz.URLOriPair instead for cross-layer use.
 
 //  3. 构造函数 (替换你的 init())
 //     它返回接口和 error
-func NewJSONOriginExtractor(filePath string) (biz.OriginExtractor, error) {
-	datas, err := os.ReadFile(filePath) // 路径由 main.go 传入
+func NewJSONOriginExtractor(filePath string, opts ...ExtractorOption) (biz.OriginExtractor, error) {
+	return loadJSONOriginExtractor(filePath, opts...)
+}
+
+// loadJSONOriginExtractor reads and validates filePath. The result is never
+// modified afterwards, so it can be shared by concurrent requests.
+func loadJSONOriginExtractor(filePath string, opts ...ExtractorOption) (*jsonOriginExtractor, error) {
+	cfg, err := readOriginConfig(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read origin file: %w", err)
+		return nil, err
 	}
+	// 检查 map 是否为空
+	if len(cfg.Items) == 0 {
+		return nil, fmt.Errorf("origin map is empty, check file: %s", filePath)
+	}
+	return newConfiguredExtractor(cfg, opts...)
+}
 
+func readOriginConfig(filePath string) (originConfig, error) {
 	var cfg originConfig
+	datas, err := os.ReadFile(filePath) // 路径由 main.go 传入
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read origin file: %w", err)
+	}
 	if err := json.Unmarshal(datas, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal origin file: %w", err)
+		return cfg, fmt.Errorf("failed to unmarshal origin file: %w", err)
+	}
+	return cfg, nil
+}
+
+// newConfiguredExtractor validates cfg and builds an extractor from it.
+func newConfiguredExtractor(cfg originConfig, opts ...ExtractorOption) (*jsonOriginExtractor, error) {
+	if err := cfg.Canonical.validate(); err != nil {
+		return nil, fmt.Errorf("invalid default canonical rule: %w", err)
+	}
+	if err := cfg.Unmapped.normalize(); err != nil {
+		return nil, fmt.Errorf("invalid unmapped rule: %w", err)
 	}
 
 	// 填充 map
 	originMap := make(map[string]string)
+	var matcher hostMatcher
+	rules := make(map[string]canonicalRule)
+	contentIDs := make(map[string][]contentIDRule)
+	shareTexts := make(map[string][]shareTextRule)
 	for _, v := range cfg.Items {
+		if err := v.validate(); err != nil {
+			return nil, err
+		}
+		if err := matcher.add(v.pattern, v.Host); err != nil {
+			return nil, err
+		}
 		originMap[v.Host] = v.Origin
+		if v.Canonical != nil {
+			rules[v.Host] = cfg.Canonical.merge(v.Canonical)
+		}
+		if len(v.ContentIDs) > 0 {
+			contentIDs[v.Host] = append(contentIDs[v.Host], v.ContentIDs...)
+		}
+		if len(v.ShareTexts) > 0 {
+			shareTexts[v.Host] = append(shareTexts[v.Host], v.ShareTexts...)
+		}
 	}
 
-	// 检查 map 是否为空
-	if len(originMap) == 0 {
-		return nil, fmt.Errorf("origin map is empty, check file: %s", filePath)
+	shortHosts := make(map[string]struct{}, len(cfg.ShortLinks))
+	for _, h := range cfg.ShortLinks {
+		shortHosts[strings.ToLower(h)] = struct{}{}
 	}
 
-	return &jsonOriginExtractor{originMap: originMap}, nil
+	e := &jsonOriginExtractor{
+		originMap:   originMap,
+		matcher:     matcher,
+		rules:       rules,
+		defaultRule: cfg.Canonical,
+		contentIDs:  contentIDs,
+		shareTexts:  shareTexts,
+		shortHosts:  shortHosts,
+		unmapped:    cfg.Unmapped,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e, nil
 }
 
 func (e *jsonOriginExtractor) ExtractAll(ctx context.Context, rawText string) ([]biz.URLOriPair, error) {
+	report, err := e.Extract(ctx, rawText)
+	if err != nil {
+		return nil, err
+	}
+	pairs := report.Pairs()
+	if len(pairs) == 0 {
+		return nil, biz.ErrInvalidArgument.WithMessage("no *supported* origin found in input text")
+	}
+	return pairs, nil
+}
+
+// schemePrefixRegex 匹配紧挨在裸域名前面的协议头，如 ftp://
+var schemePrefixRegex = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://$`)
+
+func (e *jsonOriginExtractor) Extract(ctx context.Context, rawText string) (*biz.ExtractReport, error) {
 	if rawText == "" {
 		return nil, biz.ErrInvalidArgument.WithMessage("url cannot be empty")
 	}
-
 	// 1. 先抓 http/https URL
-	httpMatches := httpURLRegex.FindAllString(rawText, -1)
+	httpMatches := httpURLRegex.FindAllStringIndex(rawText, -1)
 	// 2. 再抓裸域名/链接，尽量覆盖没写协议的情况
-	bareMatches := bareURLRegex.FindAllString(rawText, -1)
+	bareMatches := bareURLRegex.FindAllStringIndex(rawText, -1)
 
 	if len(httpMatches) == 0 && len(bareMatches) == 0 {
 		return nil, biz.ErrInvalidArgument.WithMessage("no valid URL found in input text")
 	}
 
-	// 去重：同一个“规范化 host+path+query”+Origin 只返回一次
-	seen := make(map[string]struct{})
-	pairs := make([]biz.URLOriPair, 0, len(httpMatches)+len(bareMatches))
-
-	// 规范化 URL：统一成 https:// + host（去掉前缀 www.）+ path + query
-	normalizeKey := func(u string) string {
-		u = strings.TrimSpace(u)
-		if u == "" {
-			return ""
-		}
-
-		// 如果没有协议，补一个 https://，方便解析
-		if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "//") {
-			u = "https://" + u
-		}
-
-		parsed, err := url.Parse(u)
-		if err != nil {
-			return ""
-		}
-		host := strings.TrimPrefix(parsed.Hostname(), "www.")
-		if host == "" {
-			return ""
-		}
-		path := parsed.EscapedPath()
-		query := parsed.RawQuery
-		if query != "" {
-			return host + path + "?" + query
-		}
-		return host + path
-	}
-
-	process := func(foundURL string) {
-		origin, err := e.parseAndFindOrigin(foundURL)
-		if err != nil {
-			return
-		}
-		cleanURL := strings.TrimSpace(foundURL)
-		normKey := normalizeKey(cleanURL)
-		if normKey == "" {
-			return
-		}
-		key := normKey + "|" + origin
-		if _, ok := seen[key]; ok {
-			return
-		}
-		seen[key] = struct{}{}
-		pairs = append(pairs, biz.URLOriPair{URL: cleanURL, Origin: origin})
-	}
-
-	// 对 httpMatches 里的每一个匹配，再按内部 http/https 切分，处理“多个 URL 黏在一起”的情况
-	splitHTTP := func(raw string) []string {
-		var res []string
+	// 对 httpMatches 里的每一个匹配，再按内部 http/https 切分，处理“多个 URL 黏在一起”的情况。
+	// 返回的是相对 raw 的 [start, end) 偏移。
+	splitHTTP := func(raw string) [][2]int {
+		var res [][2]int
 		i := 0
 		for i < len(raw) {
 			idx := strings.Index(raw[i:], "http")
@@ -156,31 +284,179 @@ func (e *jsonOriginExtractor) ExtractAll(ctx context.Context, rawText string) ([
 				}
 			}
 			if next == -1 {
-				res = append(res, raw[idx:])
+				res = append(res, [2]int{idx, len(raw)})
 				break
 			}
-			res = append(res, raw[idx:next])
+			res = append(res, [2]int{idx, next})
 			i = next
 		}
 		return res
 	}
 
-	for _, u := range httpMatches {
-		for _, part := range splitHTTP(u) {
-			process(part)
+	// 候选 URL 在原文中的位置：http 的在前，裸域名的在后（与原有处理顺序一致）
+	spans := make([][2]int, 0, len(httpMatches)+len(bareMatches))
+	for _, m := range httpMatches {
+		for _, part := range splitHTTP(rawText[m[0]:m[1]]) {
+			spans = append(spans, [2]int{m[0] + part[0], m[0] + part[1]})
+		}
+	}
+	// 候选只取不在 http 链接内部的裸域名：那些只是同一个链接去掉了协议头。
+	// 裸域名前如果紧跟着别的协议头（ftp:// 等），把协议头算进去，交给解析阶段拒绝。
+	candidates := slices.Clone(spans)
+	for _, m := range bareMatches {
+		span := [2]int{m[0], m[1]}
+		spans = append(spans, span)
+		if slices.ContainsFunc(httpMatches, func(h []int) bool { return h[0] <= span[0] && span[1] <= h[1] }) {
+			continue
 		}
+		if loc := schemePrefixRegex.FindStringIndex(rawText[:span[0]]); loc != nil {
+			span[0] = loc[0]
+		}
+		candidates = append(candidates, span)
 	}
-	for _, u := range bareMatches {
-		process(u)
+
+	// 去重：同一个 canonical URL + Origin 只接受一次
+	seen := make(map[string]struct{})
+	report := &biz.ExtractReport{Candidates: make([]*biz.ExtractCandidate, 0, len(candidates))}
+
+	process := func(span [2]int) *biz.ExtractCandidate {
+		cleanURL := strings.TrimSpace(rawText[span[0]:span[1]])
+		c := &biz.ExtractCandidate{Text: cleanURL}
+		target := cleanURL
+		if e.isShortLink(cleanURL) {
+			resolved, err := e.resolver.Resolve(ctx, cleanURL)
+			if err != nil {
+				logx.FromContext(ctx).Warn("short link resolve failed", "url", cleanURL, "err", err)
+				c.Reject(biz.RejectShortLink, err.Error())
+				return c
+			}
+			target = resolved
+		}
+		parsed, pattern, origin, err := e.parseAndFindOrigin(target)
+		if parsed != nil {
+			c.Key = e.ruleFor(pattern).apply(parsed)
+		}
+		if err != nil {
+			c.Reject(rejectionOf(err))
+			return c
+		}
+		c.Origin = origin
+		c.Unmapped = pattern == ""
+		key := c.Key + "|" + origin
+		if _, ok := seen[key]; ok {
+			c.Reject(biz.RejectDuplicate, "same link as an earlier one")
+			return c
+		}
+		seen[key] = struct{}{}
+		contentType, contentID := e.extractContentID(pattern, c.Key)
+		segment, before := shareTextContext(rawText, spans, span)
+		c.Status = biz.ExtractAccepted
+		c.Pair = &biz.URLOriPair{
+			URL:          cleanURL,
+			CanonicalURL: c.Key,
+			Origin:       origin,
+			ContentType:  contentType,
+			ContentID:    contentID,
+			Title:        e.extractTitle(pattern, segment, before),
+		}
+		return c
 	}
 
-	if len(pairs) == 0 {
-		return nil, biz.ErrInvalidArgument.WithMessage("no *supported* origin found in input text")
+	for _, span := range candidates {
+		report.Candidates = append(report.Candidates, process(span))
 	}
+	return report, nil
+}
 
-	return pairs, nil
+// rejection is an ErrInvalidArgument that also says which RejectReason applies.
+type rejection struct {
+	reason biz.RejectReason
+	msg    string
+	err    error
 }
-func (e *jsonOriginExtractor) parseAndFindOrigin(urlToParse string) (string, error) {
+
+func (r *rejection) Error() string { return r.err.Error() }
+func (r *rejection) Unwrap() error { return r.err }
+
+func reject(reason biz.RejectReason, msg string) error {
+	return &rejection{reason: reason, msg: msg, err: biz.ErrInvalidArgument.WithMessage(msg)}
+}
+
+// rejectionOf returns the reason and detail a candidate is rejected with.
+func rejectionOf(err error) (biz.RejectReason, string) {
+	var r *rejection
+	if errors.As(err, &r) {
+		return r.reason, r.msg
+	}
+	return biz.RejectInvalidURL, err.Error()
+}
+
+// KnownOrigin reports whether origin comes from an items entry or is the
+// fallback origin, as opposed to one derived from a host.
+func (e *jsonOriginExtractor) KnownOrigin(origin string) bool {
+	if e.unmapped.Policy == unmappedFallback && origin == e.unmapped.FallbackOrigin {
+		return true
+	}
+	for _, o := range e.originMap {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleFor returns the canonicalization rule configured for a host pattern.
+func (e *jsonOriginExtractor) ruleFor(pattern string) canonicalRule {
+	if r, ok := e.rules[pattern]; ok {
+		return r
+	}
+	return e.defaultRule
+}
+
+// isShortLink reports whether rawURL is on a configured short-link host and
+// a resolver is available to expand it.
+func (e *jsonOriginExtractor) isShortLink(rawURL string) bool {
+	if e.resolver == nil || len(e.shortHosts) == 0 {
+		return false
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "//" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	_, ok := e.shortHosts[strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")]
+	return ok
+}
+
+// extractContentID applies the host pattern's content id rules to the
+// canonical URL. It returns empty strings when no rule matches.
+func (e *jsonOriginExtractor) extractContentID(pattern, canonical string) (string, string) {
+	for _, r := range e.contentIDs[pattern] {
+		if id, ok := r.match(canonical); ok {
+			return r.Type, id
+		}
+	}
+	return "", ""
+}
+
+// extractTitle applies the host pattern's share_text rules to the text segment
+// around a link, falling back to a heuristic on the text just before it.
+func (e *jsonOriginExtractor) extractTitle(pattern, segment, before string) string {
+	for _, r := range e.shareTexts[pattern] {
+		if title, ok := r.match(segment); ok {
+			return title
+		}
+	}
+	return guessTitle(before)
+}
+
+// parseAndFindOrigin parses urlToParse and maps it to an origin. It also
+// returns the parsed URL and the key of the host pattern that matched, ""
+// when the unmapped-host policy supplied the origin; for an unsupported host
+// the URL is returned alongside the error. Errors carry a biz.RejectReason.
+func (e *jsonOriginExtractor) parseAndFindOrigin(urlToParse string) (*url.URL, string, string, error) {
 	// 1. Trim
 	preprocessedURL := strings.TrimSpace(urlToParse)
 
@@ -188,7 +464,7 @@ func (e *jsonOriginExtractor) parseAndFindOrigin(urlToParse string) (string, err
 	if !strings.HasPrefix(preprocessedURL, "http://") && !strings.HasPrefix(preprocessedURL, "https://") && !strings.HasPrefix(preprocessedURL, "//") {
 		// 检查是否是其他 "坏" 协议
 		if strings.Contains(preprocessedURL, "://") {
-			return "", biz.ErrInvalidArgument.WithMessage("unsupported protocol scheme")
+			return nil, "", "", reject(biz.RejectBadScheme, "unsupported protocol scheme")
 		}
 		// 手动添加 "//" 使其变为 "协议相对 URL"
 		preprocessedURL = "//" + preprocessedURL
@@ -197,39 +473,40 @@ func (e *jsonOriginExtractor) parseAndFindOrigin(urlToParse string) (string, err
 	// 3. 解析
 	parsedURL, err := url.Parse(preprocessedURL)
 	if err != nil {
-		return "", biz.ErrInvalidArgument.WithMessage("invalid url format: " + err.Error())
+		return nil, "", "", reject(biz.RejectInvalidURL, "invalid url format: "+err.Error())
 	}
 
 	// 4. 获取 Hostname
-	hostname := parsedURL.Hostname()
+	hostname := strings.ToLower(parsedURL.Hostname())
 	if hostname == "" {
-		return "", biz.ErrInvalidArgument.WithMessage("url is missing a host")
+		return nil, "", "", reject(biz.RejectInvalidURL, "url is missing a host")
 	}
 
-	// 5. 【关键修改】使用 publicsuffix 来获取 "eTLD+1" (例如: gemini.com)
-
-	host, err := publicsuffix.EffectiveTLDPlusOne(hostname)
+	// 5. 使用 publicsuffix 获取 "eTLD+1" (例如: gemini.com)。
+	// 它既用来排除 "README.md" 这类不是域名的文本，也是 derive 策略下的 origin
+	site, err := publicsuffix.EffectiveTLDPlusOne(hostname)
 	if err != nil {
-		// 如果 `hostname` 是 "localhost"、IP 地址或无效域名(如 "README.md")
-		// publicsuffix 会返回错误。
-
-		// 我们可以检查是否是 "README.md" 这类情况 (不包含点)
-		// 但更简单的做法是回退到使用原始 hostname
-		// 这样你的 originMap 仍然可以支持 "localhost" 或特定 IP
-		if hostname == "localhost" {
-			host = hostname
-		} else {
-			// 如果不是 localhost 且解析失败 (比如 "README.md")
-			// 我们可以直接返回错误，因为它肯定不在 originMap 中
-			return "", biz.ErrInvalidArgument.WithMessage("invalid host: " + hostname)
+		// localhost、IP 地址或无效域名(如 "README.md") 会解析失败；
+		// localhost 仍然允许在 items 里配置，其余的肯定匹配不上，直接拒绝
+		if hostname != "localhost" {
+			return nil, "", "", reject(biz.RejectInvalidURL, "invalid host: "+hostname)
 		}
+		site = hostname
 	}
 
-	// 6. 查找 map (现在 host 已经是 "gemini.com" 这样的格式了)
-	if origin, ok := e.originMap[host]; ok {
-		return origin, nil
+	// 6. 找最具体的 host 模式：精确 host 优先于通配，深的通配优先于浅的，
+	// host 相同时路径前缀越长越优先
+	if pattern, ok := e.matcher.match(hostname, parsedURL.Path); ok {
+		return parsedURL, pattern, e.originMap[pattern], nil
 	}
 
-	// 7. 查找失败
-	return "", biz.ErrInvalidArgument.WithMessage("unsupported origin: " + host)
+	// 7. 查找失败：按 unmapped 策略归到兜底 origin、用 eTLD+1 本身，或者拒绝。
+	// 拒绝时仍然返回解析结果，方便报告里给出规范化后的链接
+	switch e.unmapped.Policy {
+	case unmappedFallback:
+		return parsedURL, "", e.unmapped.FallbackOrigin, nil
+	case unmappedDerive:
+		return parsedURL, "", site, nil
+	}
+	return parsedURL, "", "", reject(biz.RejectUnsupportedHost, "unsupported origin: "+site)
 }
@@ -2,14 +2,24 @@ package data
 
 import (
 	"context"
+	"errors"
+	"net/url"
 	"testing"
+
+	"github/heimaolst/collectionbox/internal/biz"
 )
 
-// helper to construct extractor with in-memory origin map
-func newTestExtractor() *jsonOriginExtractor {
-	return &jsonOriginExtractor{originMap: map[string]string{
-		"bilibili.com": "Bilibili",
-	}}
+// helper to construct extractor for bilibili.com plus the given host -> origin pairs
+func newTestExtractor(hostOrigins ...string) *jsonOriginExtractor {
+	items := []originItem{{Host: "bilibili.com", Origin: "Bilibili"}}
+	for i := 0; i+1 < len(hostOrigins); i += 2 {
+		items = append(items, originItem{Host: hostOrigins[i], Origin: hostOrigins[i+1]})
+	}
+	e, err := newConfiguredExtractor(originConfig{Items: items})
+	if err != nil {
+		panic(err)
+	}
+	return e
 }
 
 func TestExtractAll_ConcatenatedBilibiliURLs(t *testing.T) {
@@ -61,3 +71,226 @@ func TestExtractAll_DuplicateWithAndWithoutScheme(t *testing.T) {
 		t.Fatalf("expected 1 pair, got %d: %+v", len(pairs), pairs)
 	}
 }
+
+func TestExtractAll_CanonicalStripsTrackingParams(t *testing.T) {
+	extractor := newTestExtractor()
+	extractor.rules = map[string]canonicalRule{
+		"bilibili.com": {DropQuery: []string{"spm_id_from", "vd_source"}, TrailingSlash: trailingSlashStrip},
+	}
+	text := "https://www.bilibili.com/video/BV1EasdzKEBe/?spm_id_from=333.1007&vd_source=abc " +
+		"https://m.bilibili.com/video/BV1EasdzKEBe?vd_source=def&p=2 " +
+		"https://bilibili.com/video/BV1EasdzKEBe"
+
+	pairs, err := extractor.ExtractAll(context.Background(), text)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// 第三个链接与第一个 canonical 相同；第二个 host 与 p 参数不同
+	if len(pairs) != 2 {
+		t.Fatalf("expected 2 pairs, got %d: %+v", len(pairs), pairs)
+	}
+	want := []string{
+		"https://bilibili.com/video/BV1EasdzKEBe",
+		"https://m.bilibili.com/video/BV1EasdzKEBe?p=2",
+	}
+	if pairs[0].CanonicalURL != want[0] || pairs[1].CanonicalURL != want[1] {
+		t.Fatalf("unexpected canonical urls: %+v", pairs)
+	}
+	if pairs[0].URL == pairs[0].CanonicalURL {
+		t.Fatalf("raw url should be preserved, got %s", pairs[0].URL)
+	}
+}
+
+func TestExtractAll_CanonicalDedupesTrackingVariants(t *testing.T) {
+	extractor := newTestExtractor()
+	extractor.defaultRule = canonicalRule{DropQuery: []string{"utm_*", "spm_id_from"}}
+	text := "https://www.bilibili.com/video/BV1xx411c7mD?spm_id_from=1 " +
+		"https://www.bilibili.com/video/BV1xx411c7mD?utm_source=x&utm_medium=y"
+
+	pairs, err := extractor.ExtractAll(context.Background(), text)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pairs) != 1 {
+		t.Fatalf("expected 1 pair, got %d: %+v", len(pairs), pairs)
+	}
+}
+
+func TestCanonicalRule_KeepQueryAndTrailingSlash(t *testing.T) {
+	cases := []struct {
+		rule canonicalRule
+		in   string
+		want string
+	}{
+		{canonicalRule{KeepQuery: []string{"id"}}, "https://item.taobao.com/item.htm?spm=a&id=42&ali_trackid=x", "https://item.taobao.com/item.htm?id=42"},
+		{canonicalRule{TrailingSlash: trailingSlashAdd}, "http://www.zhihu.com/question/1#answer", "https://zhihu.com/question/1/"},
+		{canonicalRule{TrailingSlash: trailingSlashStrip}, "https://zhihu.com/", "https://zhihu.com/"},
+		{canonicalRule{}, "https://zhihu.com/question/1/?b=2&a=1", "https://zhihu.com/question/1/?a=1&b=2"},
+	}
+	for _, c := range cases {
+		u, err := url.Parse(c.in)
+		if err != nil {
+			t.Fatalf("parse %s: %v", c.in, err)
+		}
+		if got := c.rule.apply(u); got != c.want {
+			t.Errorf("apply(%s) = %s, want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestExtractAll_ContentID(t *testing.T) {
+	extractor := newTestExtractor("zhihu.com", "Zhihu")
+	rules := []contentIDRule{
+		{Type: "video", Pattern: `/video/(?P<id>BV[0-9A-Za-z]{10})`},
+		{Type: "answer", Pattern: `/answer/(?P<id>\d+)`},
+		{Type: "question", Pattern: `/question/(?P<id>\d+)`},
+	}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			t.Fatalf("compile %s: %v", rules[i].Pattern, err)
+		}
+	}
+	extractor.contentIDs = map[string][]contentIDRule{
+		"bilibili.com": rules[:1],
+		"zhihu.com":    rules[1:],
+	}
+	text := "https://m.bilibili.com/video/BV1xx411c7mD?share_source=copy " +
+		"https://www.zhihu.com/question/123/answer/456 " +
+		"https://www.zhihu.com/question/789 " +
+		"https://www.bilibili.com/"
+
+	pairs, err := extractor.ExtractAll(context.Background(), text)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := [][2]string{{"video", "BV1xx411c7mD"}, {"answer", "456"}, {"question", "789"}, {"", ""}}
+	if len(pairs) != len(want) {
+		t.Fatalf("expected %d pairs, got %d: %+v", len(want), len(pairs), pairs)
+	}
+	for i, w := range want {
+		if pairs[i].ContentType != w[0] || pairs[i].ContentID != w[1] {
+			t.Errorf("pair %d: got %s/%s, want %s/%s", i, pairs[i].ContentType, pairs[i].ContentID, w[0], w[1])
+		}
+	}
+}
+
+func TestExtractAll_ShareTextTitle(t *testing.T) {
+	extractor := newTestExtractor("douyin.com", "Douyin")
+	rules := []shareTextRule{
+		{Pattern: `【(?P<title>[^】]+?)(?:-哔哩哔哩)?】`},
+		{Pattern: `看看【(?P<title>[^】]+)】`},
+	}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			t.Fatalf("compile %s: %v", rules[i].Pattern, err)
+		}
+	}
+	extractor.shareTexts = map[string][]shareTextRule{
+		"bilibili.com": rules[:1],
+		"douyin.com":   rules[1:],
+	}
+	text := "【Go 并发入门-哔哩哔哩】 https://www.bilibili.com/video/BV1xx411c7mD\n" +
+		"8.9 复制打开抖音，看看【小王的作品】今天的晚饭 # 美食 https://www.douyin.com/video/123 复制此链接\n" +
+		"gorm 使用笔记：https://www.bilibili.com/video/BV19qxNzXEWT"
+
+	pairs, err := extractor.ExtractAll(context.Background(), text)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"Go 并发入门", "小王的作品", "gorm 使用笔记"}
+	if len(pairs) != len(want) {
+		t.Fatalf("expected %d pairs, got %d: %+v", len(want), len(pairs), pairs)
+	}
+	for i, w := range want {
+		if pairs[i].Title != w {
+			t.Errorf("pair %d: title %q, want %q", i, pairs[i].Title, w)
+		}
+	}
+}
+
+func TestExtract_Report(t *testing.T) {
+	extractor := newTestExtractor()
+	text := "a https://www.bilibili.com/video/BV1 b https://example.com/x c ftp://bilibili.com/video/BV2 d bilibili.com/video/BV1"
+
+	report, err := extractor.Extract(context.Background(), text)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []struct {
+		text   string
+		status biz.ExtractStatus
+		reason biz.RejectReason
+		key    string
+	}{
+		{"https://www.bilibili.com/video/BV1", biz.ExtractAccepted, "", "https://bilibili.com/video/BV1"},
+		{"https://example.com/x", biz.ExtractRejected, biz.RejectUnsupportedHost, "https://example.com/x"},
+		{"ftp://bilibili.com/video/BV2", biz.ExtractRejected, biz.RejectBadScheme, ""},
+		{"bilibili.com/video/BV1", biz.ExtractRejected, biz.RejectDuplicate, "https://bilibili.com/video/BV1"},
+	}
+	if len(report.Candidates) != len(want) {
+		t.Fatalf("got %d candidates, want %d: %+v", len(report.Candidates), len(want), report.Candidates)
+	}
+	for i, w := range want {
+		c := report.Candidates[i]
+		if c.Text != w.text || c.Status != w.status || c.Reason != w.reason || c.Key != w.key {
+			t.Errorf("candidate %d = %q %s/%s key %q, want %q %s/%s key %q",
+				i, c.Text, c.Status, c.Reason, c.Key, w.text, w.status, w.reason, w.key)
+		}
+	}
+	if pairs := report.Pairs(); len(pairs) != 1 || pairs[0].Origin != "Bilibili" {
+		t.Errorf("Pairs() = %+v, want the one bilibili link", pairs)
+	}
+}
+
+func TestExtract_NoCandidate(t *testing.T) {
+	extractor := newTestExtractor()
+	for _, text := range []string{"", "   ", "no links here", "https://"} {
+		if report, err := extractor.Extract(context.Background(), text); !errors.Is(err, biz.ErrInvalidArgument) {
+			t.Errorf("Extract(%q) = %+v, %v; want ErrInvalidArgument", text, report, err)
+		}
+	}
+	// a candidate that is rejected is still reported
+	report, err := extractor.Extract(context.Background(), "see README.md")
+	if err != nil || len(report.Candidates) != 1 || report.Candidates[0].Status != biz.ExtractRejected {
+		t.Errorf("Extract(README.md) = %+v, %v; want one rejected candidate", report, err)
+	}
+}
+
+func TestExtract_UnmappedPolicy(t *testing.T) {
+	text := "https://www.bilibili.com/video/BV1 https://gist.github.com/someone/1"
+	for _, tc := range []struct {
+		cfg        unmappedConfig
+		wantOrigin string
+	}{
+		{unmappedConfig{Policy: unmappedReject}, ""},
+		{unmappedConfig{Policy: unmappedFallback}, "Other"},
+		{unmappedConfig{Policy: unmappedFallback, FallbackOrigin: "Misc"}, "Misc"},
+		{unmappedConfig{Policy: unmappedDerive}, "github.com"},
+	} {
+		if err := tc.cfg.normalize(); err != nil {
+			t.Fatal(err)
+		}
+		extractor := newTestExtractor()
+		extractor.unmapped = tc.cfg
+		report, err := extractor.Extract(context.Background(), text)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.cfg.Policy, err)
+		}
+		c := report.Candidates[1]
+		if c.Origin != tc.wantOrigin || (tc.wantOrigin != "") != (c.Status == biz.ExtractAccepted) {
+			t.Errorf("%s: github link = %s origin %q, want origin %q", tc.cfg.Policy, c.Status, c.Origin, tc.wantOrigin)
+		}
+		if tc.wantOrigin != "" && !c.Unmapped {
+			t.Errorf("%s: github link not marked unmapped", tc.cfg.Policy)
+		}
+		if report.Candidates[0].Unmapped {
+			t.Errorf("%s: configured bilibili link marked unmapped", tc.cfg.Policy)
+		}
+		if got := extractor.KnownOrigin(tc.wantOrigin); tc.wantOrigin != "" && got != (tc.cfg.Policy == unmappedFallback) {
+			t.Errorf("%s: KnownOrigin(%q) = %v", tc.cfg.Policy, tc.wantOrigin, got)
+		}
+	}
+	if err := (&unmappedConfig{Policy: "guess"}).normalize(); err == nil {
+		t.Error("unknown policy accepted")
+	}
+}
@@ -0,0 +1,127 @@
+package data
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// hostPattern is the parsed "host" of an origin item. It takes three forms:
+//
+//	v.qq.com            exact host (a leading "www." is ignored)
+//	*.163.com           the domain and every subdomain of it
+//	mp.weixin.qq.com/s  either of the above, limited to a path prefix
+//
+// A registrable domain on its own, like "bilibili.com", covers its
+// subdomains as if it were written "*.bilibili.com"; that is how every
+// origin.json item behaved before patterns existed.
+type hostPattern struct {
+	host     string
+	wildcard bool
+	// path is "" or a prefix like "/s" that must match whole segments
+	path string
+}
+
+// parseHostPattern parses s and returns it with its canonical spelling:
+// lower-case host, no "www.", no trailing slash, and the wildcard left
+// implicit for registrable domains. Equivalent patterns share one spelling.
+// The path keeps its case, as URL paths are case-sensitive.
+func parseHostPattern(s string) (hostPattern, string, error) {
+	s = strings.TrimSpace(s)
+	host, path, hasPath := strings.Cut(s, "/")
+	host = strings.ToLower(host)
+	var p hostPattern
+	if rest, ok := strings.CutPrefix(host, "*."); ok {
+		p.wildcard, host = true, rest
+	}
+	host = strings.TrimPrefix(host, "www.")
+	if host == "" || strings.ContainsAny(host, "*:@ \t") || strings.HasPrefix(host, ".") || strings.HasSuffix(host, ".") {
+		return p, "", fmt.Errorf("invalid host pattern %q: want a host like v.qq.com or *.qq.com, optionally followed by a path", s)
+	}
+	p.host = host
+	if hasPath {
+		if strings.ContainsAny(path, "?# \t") {
+			return p, "", fmt.Errorf("invalid host pattern %q: the path prefix can't hold a query or fragment", s)
+		}
+		if path = strings.TrimRight(path, "/"); path != "" {
+			p.path = "/" + path
+		}
+	}
+	key := p.host
+	if registrable(host) {
+		p.wildcard = true
+	} else if p.wildcard {
+		key = "*." + key
+	}
+	return p, key + p.path, nil
+}
+
+// registrable reports whether host is an eTLD+1 such as bilibili.com.
+func registrable(host string) bool {
+	etld1, err := publicsuffix.EffectiveTLDPlusOne(host)
+	return err == nil && etld1 == host
+}
+
+// matches reports whether a link on host with the given path falls under p.
+func (p hostPattern) matches(host, path string) bool {
+	host = strings.TrimPrefix(host, "www.")
+	if host != p.host && !(p.wildcard && strings.HasSuffix(host, "."+p.host)) {
+		return false
+	}
+	if p.path == "" {
+		return true
+	}
+	return path == p.path || strings.HasPrefix(path, p.path+"/")
+}
+
+// compareSpecificity orders patterns most specific first: an exact host
+// beats a wildcard, a deeper wildcard beats a shallower one, and with the
+// host settled a longer path prefix wins.
+func compareSpecificity(a, b hostPattern) int {
+	if a.wildcard != b.wildcard {
+		if a.wildcard {
+			return 1
+		}
+		return -1
+	}
+	if c := cmp.Compare(strings.Count(b.host, "."), strings.Count(a.host, ".")); c != 0 {
+		return c
+	}
+	return cmp.Compare(len(b.path), len(a.path))
+}
+
+// hostMatcher finds the most specific pattern matching a link.
+type hostMatcher struct {
+	patterns []hostPattern
+	// keys[i] is the canonical spelling of patterns[i]
+	keys []string
+}
+
+var errDuplicatePattern = errors.New("duplicate host pattern")
+
+// add registers p under key; a second pattern with the same key is refused.
+// Patterns of equal specificity can't match the same link, so their order
+// doesn't matter.
+func (m *hostMatcher) add(p hostPattern, key string) error {
+	if slices.Contains(m.keys, key) {
+		return fmt.Errorf("%w %q", errDuplicatePattern, key)
+	}
+	i, _ := slices.BinarySearchFunc(m.patterns, p, compareSpecificity)
+	m.patterns = slices.Insert(m.patterns, i, p)
+	m.keys = slices.Insert(m.keys, i, key)
+	return nil
+}
+
+// match returns the key of the most specific pattern covering host and path.
+func (m *hostMatcher) match(host, path string) (string, bool) {
+	for i, p := range m.patterns {
+		if p.matches(host, path) {
+			return m.keys[i], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,91 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParseHostPattern(t *testing.T) {
+	cases := []struct {
+		in, key  string
+		wildcard bool
+	}{
+		{"Bilibili.com", "bilibili.com", true},
+		{"*.bilibili.com", "bilibili.com", true},
+		{"www.zhihu.com", "zhihu.com", true},
+		{"sina.com.cn", "sina.com.cn", true},
+		{"v.qq.com", "v.qq.com", false},
+		{"*.weixin.qq.com", "*.weixin.qq.com", true},
+		{"mp.weixin.qq.com/s/", "mp.weixin.qq.com/s", false},
+		{"GitHub.com/HeimaoLST/", "github.com/HeimaoLST", true},
+		{"163.com/", "163.com", true},
+		{"localhost", "localhost", false},
+	}
+	for _, tc := range cases {
+		p, key, err := parseHostPattern(tc.in)
+		if err != nil || key != tc.key || p.wildcard != tc.wildcard {
+			t.Errorf("parseHostPattern(%q) = %q wildcard=%v, %v; want %q wildcard=%v", tc.in, key, p.wildcard, err, tc.key, tc.wildcard)
+		}
+	}
+	for _, bad := range []string{"", "*", "*.", "a.*.com", "https://a.com", "a.com/x?y=1", ".a.com"} {
+		if _, _, err := parseHostPattern(bad); err == nil {
+			t.Errorf("parseHostPattern(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestExtract_HostPatternPrecedence(t *testing.T) {
+	extractor := newTestExtractor(
+		"qq.com", "Tencent",
+		"v.qq.com", "Tencent Video",
+		"*.weixin.qq.com", "Weixin",
+		"mp.weixin.qq.com/s", "WeChat",
+		"*.qq.com/x", "Tencent X",
+		"163.com", "Netease",
+		"music.163.com", "Netease Music",
+		"github.com", "GitHub",
+		"github.com/HeimaoLST", "HeimaoLST",
+	)
+	cases := []struct{ url, origin string }{
+		// exact host beats the wildcard, even one with a path
+		{"https://v.qq.com/x/cover/abc.html", "Tencent Video"},
+		{"https://www.v.qq.com/x/cover/abc.html", "Tencent Video"},
+		// an exact host doesn't cover its subdomains
+		{"https://m.v.qq.com/x/cover/abc.html", "Tencent X"},
+		{"https://m.v.qq.com/cover/abc.html", "Tencent"},
+		// a registrable domain covers itself and every subdomain
+		{"https://qq.com/", "Tencent"},
+		{"https://news.qq.com/a/1", "Tencent"},
+		// path prefixes match whole segments, the longest winning
+		{"https://news.qq.com/x/1", "Tencent X"},
+		{"https://news.qq.com/xy", "Tencent"},
+		{"https://mp.weixin.qq.com/s/abcdef", "WeChat"},
+		{"https://mp.weixin.qq.com/s?__biz=MzA&mid=1", "WeChat"},
+		{"https://mp.weixin.qq.com/sx", "Weixin"},
+		// a deeper wildcard beats a shallower one
+		{"https://weixin.qq.com/", "Weixin"},
+		{"https://work.weixin.qq.com/x", "Weixin"},
+		{"https://music.163.com/#/song?id=1", "Netease Music"},
+		{"https://news.163.com/a", "Netease"},
+		// path prefixes keep their case; hosts don't
+		{"https://GitHub.com/HeimaoLST/CollectionBox", "HeimaoLST"},
+		{"https://github.com/heimaolst/CollectionBox", "GitHub"},
+	}
+	for _, tc := range cases {
+		pairs, err := extractor.ExtractAll(context.Background(), tc.url)
+		if err != nil || len(pairs) != 1 || pairs[0].Origin != tc.origin {
+			t.Errorf("%s = %+v, %v; want origin %s", tc.url, pairs, err, tc.origin)
+		}
+	}
+}
+
+func TestHostPatternDuplicates(t *testing.T) {
+	_, err := newConfiguredExtractor(originConfig{Items: []originItem{
+		{Host: "bilibili.com", Origin: "Bilibili"},
+		{Host: "*.bilibili.com", Origin: "Bilibili again"},
+	}})
+	if !errors.Is(err, errDuplicatePattern) {
+		t.Errorf("equivalent patterns = %v, want errDuplicatePattern", err)
+	}
+}
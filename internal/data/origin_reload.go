@@ -0,0 +1,219 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/biz"
+	"github/heimaolst/collectionbox/internal/logx"
+)
+
+// ReloadingOriginExtractor serves extraction from the last valid version of an
+// origin config. Reload swaps in a freshly built config atomically: every
+// call works on the config that was current when it started, and a config
+// that fails to load or validate leaves the previous one in place.
+type ReloadingOriginExtractor struct {
+	// path is the config file Watch looks at
+	path string
+	// loadedFile is path as stat'ed before the first load, where Watch starts
+	// comparing from; nil if it couldn't be stat'ed
+	loadedFile os.FileInfo
+	load       func(ctx context.Context) (*jsonOriginExtractor, error)
+	// ttl > 0 rebuilds the config on use once it is older than ttl
+	ttl time.Duration
+	cur atomic.Pointer[jsonOriginExtractor]
+	// loadedAt is the UnixNano time of the last load attempt
+	loadedAt atomic.Int64
+	// stale is set by Invalidate
+	stale atomic.Bool
+	// mu serializes reloads so concurrent ones don't log misleading diffs
+	mu sync.Mutex
+}
+
+var (
+	_ biz.OriginExtractor = (*ReloadingOriginExtractor)(nil)
+	_ biz.OriginCache     = (*ReloadingOriginExtractor)(nil)
+)
+
+// NewReloadingOriginExtractor loads filePath like NewJSONOriginExtractor.
+func NewReloadingOriginExtractor(filePath string, opts ...ExtractorOption) (*ReloadingOriginExtractor, error) {
+	return newReloadingOriginExtractor(context.Background(), filePath, 0, func(context.Context) (*jsonOriginExtractor, error) {
+		return loadJSONOriginExtractor(filePath, opts...)
+	})
+}
+
+// NewDBOriginExtractor serves extraction from the origins in repo. The
+// config file at settingsPath only supplies what all origins share (the
+// default canonical rule, short_links and unmapped); its items are ignored.
+// The built config is cached until Invalidate or Reload is called, or, when
+// ttl > 0, until it is older than ttl, which picks up changes other
+// instances made to a shared database.
+func NewDBOriginExtractor(ctx context.Context, settingsPath string, repo biz.OriginRepo, ttl time.Duration, opts ...ExtractorOption) (*ReloadingOriginExtractor, error) {
+	return newReloadingOriginExtractor(ctx, settingsPath, ttl, func(ctx context.Context) (*jsonOriginExtractor, error) {
+		return loadDBOriginExtractor(ctx, settingsPath, repo, opts...)
+	})
+}
+
+func newReloadingOriginExtractor(ctx context.Context, path string, ttl time.Duration, load func(context.Context) (*jsonOriginExtractor, error)) (*ReloadingOriginExtractor, error) {
+	// stat first: an edit during the load then still counts as a change
+	fi, _ := os.Stat(path)
+	e, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := &ReloadingOriginExtractor{path: path, loadedFile: fi, load: load, ttl: ttl}
+	r.cur.Store(e)
+	r.loadedAt.Store(time.Now().UnixNano())
+	return r, nil
+}
+
+// loadDBOriginExtractor builds an extractor from the settings in settingsPath
+// and the origins in repo. An origin whose rules no longer validate, or that
+// repeats an earlier host pattern, is skipped rather than taking every other
+// origin down with it.
+func loadDBOriginExtractor(ctx context.Context, settingsPath string, repo biz.OriginRepo, opts ...ExtractorOption) (*jsonOriginExtractor, error) {
+	cfg, err := readOriginConfig(settingsPath)
+	if err != nil {
+		return nil, err
+	}
+	origins, err := repo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list origins: %w", err)
+	}
+	cfg.Items = make([]originItem, 0, len(origins))
+	seen := make(map[string]int64, len(origins))
+	for _, o := range origins {
+		item, err := originItemOf(o)
+		if err != nil {
+			logx.FromContext(ctx).Warn("skipping invalid origin", "id", o.ID, "host", o.Host, "err", err)
+			continue
+		}
+		// rows written before host patterns were canonicalized may spell the
+		// same pattern twice; the first one wins
+		if id, ok := seen[item.Host]; ok {
+			logx.FromContext(ctx).Warn("skipping origin with a duplicate host pattern", "id", o.ID, "host", o.Host, "duplicate_of", id)
+			continue
+		}
+		seen[item.Host] = o.ID
+		cfg.Items = append(cfg.Items, item)
+	}
+	return newConfiguredExtractor(cfg, opts...)
+}
+
+func (r *ReloadingOriginExtractor) ExtractAll(ctx context.Context, rawText string) ([]biz.URLOriPair, error) {
+	return r.current(ctx).ExtractAll(ctx, rawText)
+}
+
+func (r *ReloadingOriginExtractor) Extract(ctx context.Context, rawText string) (*biz.ExtractReport, error) {
+	return r.current(ctx).Extract(ctx, rawText)
+}
+
+func (r *ReloadingOriginExtractor) KnownOrigin(origin string) bool {
+	return r.current(context.Background()).KnownOrigin(origin)
+}
+
+// Invalidate makes the next call rebuild the config.
+func (r *ReloadingOriginExtractor) Invalidate() {
+	r.stale.Store(true)
+}
+
+// current returns the config to use, first rebuilding it if it is stale or
+// expired. Only one caller rebuilds; the others carry on with the old config.
+func (r *ReloadingOriginExtractor) current(ctx context.Context) *jsonOriginExtractor {
+	if r.needsRefresh() && r.mu.TryLock() {
+		if r.needsRefresh() {
+			r.stale.Store(false)
+			_ = r.reloadLocked(ctx, false)
+		}
+		r.mu.Unlock()
+	}
+	return r.cur.Load()
+}
+
+func (r *ReloadingOriginExtractor) needsRefresh() bool {
+	if r.stale.Load() {
+		return true
+	}
+	return r.ttl > 0 && time.Since(time.Unix(0, r.loadedAt.Load())) > r.ttl
+}
+
+// Reload rebuilds the config and swaps it in, logging which hosts were
+// added, removed or moved to another origin. On error the old config stays.
+func (r *ReloadingOriginExtractor) Reload(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reloadLocked(ctx, true)
+}
+
+// reloadLocked loads the config; a refresh that changed no host is logged
+// only when verbose is set.
+func (r *ReloadingOriginExtractor) reloadLocked(ctx context.Context, verbose bool) error {
+	log := logx.FromContext(ctx)
+	next, err := r.load(ctx)
+	r.loadedAt.Store(time.Now().UnixNano())
+	if err != nil {
+		log.Error("origin config reload failed, keeping the previous one", "path", r.path, "err", err)
+		return err
+	}
+	prev := r.cur.Swap(next)
+	added, removed, changed := diffOriginMaps(prev.originMap, next.originMap)
+	if verbose || len(added)+len(removed)+len(changed) > 0 {
+		log.Info("origin config reloaded", "path", r.path,
+			"hosts", len(next.originMap), "added", added, "removed", removed, "changed", changed)
+	}
+	return nil
+}
+
+// Watch reloads the config whenever the file's modification time or size
+// changes, checking every interval until ctx is cancelled. Edits made after
+// the extractor was built but before Watch started are picked up too.
+func (r *ReloadingOriginExtractor) Watch(ctx context.Context, interval time.Duration) {
+	last := r.loadedFile
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fi, err := os.Stat(r.path)
+		if err != nil {
+			// an editor may be replacing the file; try again next tick
+			continue
+		}
+		if last != nil && fi.ModTime().Equal(last.ModTime()) && fi.Size() == last.Size() {
+			continue
+		}
+		last = fi
+		_ = r.Reload(ctx)
+	}
+}
+
+// diffOriginMaps compares two host -> origin maps. changed lists hosts as
+// "host: old -> new".
+func diffOriginMaps(prev, next map[string]string) (added, removed, changed []string) {
+	for host, origin := range next {
+		old, ok := prev[host]
+		switch {
+		case !ok:
+			added = append(added, host)
+		case old != origin:
+			changed = append(changed, host+": "+old+" -> "+origin)
+		}
+	}
+	for host := range prev {
+		if _, ok := next[host]; !ok {
+			removed = append(removed, host)
+		}
+	}
+	slices.Sort(added)
+	slices.Sort(removed)
+	slices.Sort(changed)
+	return added, removed, changed
+}
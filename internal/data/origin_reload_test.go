@@ -0,0 +1,229 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/biz"
+)
+
+func writeOriginConfig(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadingOriginExtractor(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "origin.json")
+	writeOriginConfig(t, path, `{"items":[{"host":"a.com","origin":"A"},{"host":"b.com","origin":"B"}]}`)
+	e, err := NewReloadingOriginExtractor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.ExtractAll(ctx, "https://c.com/1"); err == nil {
+		t.Fatal("c.com accepted before it was configured")
+	}
+
+	writeOriginConfig(t, path, `{"items":[{"host":"a.com","origin":"A2"},{"host":"c.com","origin":"C"}]}`)
+	if err := e.Reload(ctx); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if pairs, err := e.ExtractAll(ctx, "https://c.com/1"); err != nil || pairs[0].Origin != "C" {
+		t.Errorf("after reload c.com = %+v, %v; want origin C", pairs, err)
+	}
+
+	// a broken file keeps the previous config
+	writeOriginConfig(t, path, `{"items":[`)
+	if err := e.Reload(ctx); err == nil {
+		t.Error("Reload accepted a broken file")
+	}
+	if pairs, err := e.ExtractAll(ctx, "https://a.com/1"); err != nil || pairs[0].Origin != "A2" {
+		t.Errorf("after failed reload a.com = %+v, %v; want origin A2", pairs, err)
+	}
+}
+
+func TestDiffOriginMaps(t *testing.T) {
+	added, removed, changed := diffOriginMaps(
+		map[string]string{"a.com": "A", "b.com": "B"},
+		map[string]string{"a.com": "A2", "c.com": "C"},
+	)
+	if !slices.Equal(added, []string{"c.com"}) || !slices.Equal(removed, []string{"b.com"}) || !slices.Equal(changed, []string{"a.com: A -> A2"}) {
+		t.Errorf("diff = %v, %v, %v", added, removed, changed)
+	}
+}
+
+func TestReloadDuringExtraction(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "origin.json")
+	configs := []string{
+		`{"items":[{"host":"a.com","origin":"A"}]}`,
+		`{"items":[{"host":"a.com","origin":"A"},{"host":"b.com","origin":"B"}]}`,
+	}
+	writeOriginConfig(t, path, configs[0])
+	e, err := NewReloadingOriginExtractor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			for range 200 {
+				if pairs, err := e.ExtractAll(ctx, "https://a.com/1 https://b.com/2"); err != nil || pairs[0].Origin != "A" {
+					t.Errorf("ExtractAll = %+v, %v", pairs, err)
+					return
+				}
+			}
+		})
+	}
+	// no t.Fatal while the workers run: they report through t too
+	for i := range 50 {
+		if err := os.WriteFile(path, []byte(configs[i%2]), 0o644); err != nil {
+			t.Error(err)
+			break
+		}
+		if err := e.Reload(ctx); err != nil {
+			t.Error(err)
+			break
+		}
+	}
+	wg.Wait()
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "origin.json")
+	writeOriginConfig(t, path, `{"items":[{"host":"a.com","origin":"A"}]}`)
+	e, err := NewReloadingOriginExtractor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Watch(ctx, 5*time.Millisecond)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// the size changes too, so a coarse mtime can't hide the edit
+	writeOriginConfig(t, path, `{"items":[{"host":"a.com","origin":"A"},{"host":"c.com","origin":"C"}]}`)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if pairs, err := e.ExtractAll(context.Background(), "https://c.com/1"); err == nil && pairs[0].Origin == "C" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Watch did not pick up the edited file")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// a broken edit is skipped and the next good one is still picked up
+	writeOriginConfig(t, path, `{"items":[`)
+	time.Sleep(20 * time.Millisecond)
+	if pairs, err := e.ExtractAll(context.Background(), "https://c.com/1"); err != nil || pairs[0].Origin != "C" {
+		t.Errorf("after a broken edit c.com = %+v, %v; want origin C kept", pairs, err)
+	}
+	writeOriginConfig(t, path, `{"items":[{"host":"a.com","origin":"A2"}]}`)
+	deadline = time.Now().Add(2 * time.Second)
+	for {
+		if pairs, err := e.ExtractAll(context.Background(), "https://a.com/1"); err == nil && pairs[0].Origin == "A2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Watch stopped after a broken edit")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Watch kept running after ctx was cancelled")
+	}
+}
+
+func TestDBOriginExtractor(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "origin.json")
+	// items in the file are ignored once origins live in the database
+	writeOriginConfig(t, path, `{"canonical":{"drop_query":["utm_*"]},"items":[{"host":"a.com","origin":"A"}]}`)
+	repo := NewMemoryOriginRepo()
+	e, err := NewDBOriginExtractor(ctx, path, repo, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.ExtractAll(ctx, "https://a.com/1"); err == nil {
+		t.Fatal("a.com accepted from the file's items")
+	}
+
+	uc := biz.NewOriginUsecase(repo, e)
+	o, err := uc.Create(ctx, &biz.Origin{Host: "A.com", Name: "A", Canonical: json.RawMessage(`{"drop_query":["ref"]}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs, err := e.ExtractAll(ctx, "https://a.com/1?ref=x&utm_source=y&id=2")
+	if err != nil || pairs[0].Origin != "A" || pairs[0].CanonicalURL != "https://a.com/1?id=2" {
+		t.Fatalf("after Create = %+v, %v; want origin A with ref and utm_source dropped", pairs, err)
+	}
+
+	// writes that bypass the usecase are only seen once the cache expires
+	if err := repo.Delete(ctx, o.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.ExtractAll(ctx, "https://a.com/1"); err != nil {
+		t.Errorf("cached a.com lost before the ttl: %v", err)
+	}
+	e.ttl = time.Nanosecond
+	if _, err := e.ExtractAll(ctx, "https://a.com/1"); err == nil {
+		t.Error("a.com still accepted after its origin expired from the cache")
+	}
+}
+
+func TestSeedOrigins(t *testing.T) {
+	ctx := context.Background()
+	const path = "../../resource/origin.json"
+	repo := NewMemoryOriginRepo()
+	n, err := SeedOrigins(ctx, repo, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _ := readOriginConfig(path)
+	if n == 0 || n != len(cfg.Items) {
+		t.Fatalf("seeded %d origins, want %d", n, len(cfg.Items))
+	}
+	if n, err := SeedOrigins(ctx, repo, path); err != nil || n != 0 {
+		t.Errorf("second seed = %d, %v; want a no-op", n, err)
+	}
+
+	// the seeded table extracts exactly like the file it came from
+	fromFile, err := loadJSONOriginExtractor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromDB, err := loadDBOriginExtractor(ctx, path, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const text = "【标题】 https://www.bilibili.com/video/BV1xx411c7mD/?vd_source=x&spm_id_from=y https://www.zhihu.com/question/1?utm_source=z"
+	want, err := fromFile.ExtractAll(ctx, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fromDB.ExtractAll(ctx, text)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("seeded extraction = %+v, %v; want %+v", got, err, want)
+	}
+}
@@ -0,0 +1,445 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/biz"
+	"github/heimaolst/collectionbox/internal/logx"
+
+	"gorm.io/gorm"
+)
+
+// OriginPO is one row of the origins table. The rule columns hold the JSON
+// of the matching origin.json item keys, "" when the origin has none.
+type OriginPO struct {
+	ID         int64  `gorm:"primaryKey"`
+	Host       string `gorm:"size:255;not null;uniqueIndex"`
+	Name       string `gorm:"size:255;not null"`
+	Icon       string `gorm:"type:text"`
+	Canonical  string `gorm:"type:text"`
+	ContentIDs string `gorm:"type:text"`
+	ShareText  string `gorm:"type:text"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (OriginPO) TableName() string { return "origins" }
+
+// OriginSeedPO records a host seeded from origin.json, whether or not its
+// origin still exists.
+type OriginSeedPO struct {
+	Host     string `gorm:"primaryKey;size:255"`
+	SeededAt time.Time
+}
+
+func (OriginSeedPO) TableName() string { return "origin_seeds" }
+
+func originFromBiz(o *biz.Origin) *OriginPO {
+	return &OriginPO{
+		ID:         o.ID,
+		Host:       o.Host,
+		Name:       o.Name,
+		Icon:       o.Icon,
+		Canonical:  ruleText(o.Canonical),
+		ContentIDs: ruleText(o.ContentIDs),
+		ShareText:  ruleText(o.ShareText),
+		CreatedAt:  o.CreatedAt,
+		UpdatedAt:  o.UpdatedAt,
+	}
+}
+
+func (po *OriginPO) toBiz() *biz.Origin {
+	return &biz.Origin{
+		ID:         po.ID,
+		Host:       po.Host,
+		Name:       po.Name,
+		Icon:       po.Icon,
+		Canonical:  ruleJSON(po.Canonical),
+		ContentIDs: ruleJSON(po.ContentIDs),
+		ShareText:  ruleJSON(po.ShareText),
+		CreatedAt:  po.CreatedAt,
+		UpdatedAt:  po.UpdatedAt,
+	}
+}
+
+// ruleText compacts a rule for storage; null and empty rules become "".
+func ruleText(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil || buf.String() == "null" {
+		return ""
+	}
+	return buf.String()
+}
+
+func ruleJSON(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	return json.RawMessage(s)
+}
+
+// originItemOf converts o to the origin.json item the extractor is built
+// from, compiling its rules; the item's Host is the canonical spelling of
+// o.Host. Unknown rule keys are refused so a typo doesn't
+// silently disable a rule.
+func originItemOf(o *biz.Origin) (originItem, error) {
+	item := originItem{Host: o.Host, Origin: o.Name, Icon: o.Icon}
+	rules := []struct {
+		key string
+		raw json.RawMessage
+		dst any
+	}{
+		{"canonical", o.Canonical, &item.Canonical},
+		{"content_ids", o.ContentIDs, &item.ContentIDs},
+		{"share_text", o.ShareText, &item.ShareTexts},
+	}
+	for _, r := range rules {
+		raw := bytes.TrimSpace(r.raw)
+		if len(raw) == 0 || string(raw) == "null" {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(r.dst); err != nil {
+			return item, biz.ErrInvalidArgument.WithMessage(fmt.Sprintf("%s: %v", r.key, err))
+		}
+	}
+	if err := item.validate(); err != nil {
+		return item, biz.ErrInvalidArgument.WithMessage(err.Error())
+	}
+	return item, nil
+}
+
+// originOfItem is the reverse of originItemOf, used to seed the table.
+func originOfItem(item originItem) (*biz.Origin, error) {
+	o := &biz.Origin{Host: item.Host, Name: item.Origin, Icon: item.Icon}
+	var err error
+	marshal := func(v any) json.RawMessage {
+		raw, e := json.Marshal(v)
+		if e != nil {
+			err = e
+		}
+		return raw
+	}
+	if item.Canonical != nil {
+		o.Canonical = marshal(item.Canonical)
+	}
+	if len(item.ContentIDs) > 0 {
+		o.ContentIDs = marshal(item.ContentIDs)
+	}
+	if len(item.ShareTexts) > 0 {
+		o.ShareText = marshal(item.ShareTexts)
+	}
+	return o, err
+}
+
+// SeedOrigins adds the items of the origin config at filePath that were
+// never seeded into repo, and returns how many were added. Items added to the
+// file later still reach an existing database, while a seeded origin that was
+// edited or deleted through repo is left alone.
+func SeedOrigins(ctx context.Context, repo biz.OriginRepo, filePath string) (int, error) {
+	cfg, err := readOriginConfig(filePath)
+	if err != nil {
+		return 0, err
+	}
+	origins := make([]*biz.Origin, 0, len(cfg.Items))
+	for _, item := range cfg.Items {
+		o, err := originOfItem(item)
+		if err != nil {
+			return 0, fmt.Errorf("seed origin %s: %w", item.Host, err)
+		}
+		origins = append(origins, o)
+	}
+	n, err := repo.Seed(ctx, origins)
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 {
+		logx.FromContext(ctx).Info("origins seeded", "path", filePath, "count", n)
+	}
+	return n, nil
+}
+
+type sqlOriginRepo struct {
+	db *gorm.DB
+}
+
+// NewSQLOriginRepo expects a schema brought up to date by MigrateUp.
+func NewSQLOriginRepo(db *gorm.DB) biz.OriginRepo {
+	return &sqlOriginRepo{db: db}
+}
+
+func (repo *sqlOriginRepo) List(ctx context.Context) ([]*biz.Origin, error) {
+	var pos []*OriginPO
+	if err := repo.db.WithContext(ctx).Order("host").Find(&pos).Error; err != nil {
+		return nil, wrapQueryError(err)
+	}
+	origins := make([]*biz.Origin, len(pos))
+	for i, po := range pos {
+		origins[i] = po.toBiz()
+	}
+	return origins, nil
+}
+
+func (repo *sqlOriginRepo) Get(ctx context.Context, id int64) (*biz.Origin, error) {
+	var po OriginPO
+	err := repo.db.WithContext(ctx).Where("id = ?", id).First(&po).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, biz.ErrNotFound.WithMessage("origin " + strconv.FormatInt(id, 10))
+	}
+	if err != nil {
+		return nil, wrapQueryError(err)
+	}
+	return po.toBiz(), nil
+}
+
+func (repo *sqlOriginRepo) Create(ctx context.Context, o *biz.Origin) error {
+	item, err := originItemOf(o)
+	if err != nil {
+		return err
+	}
+	o.Host = item.Host
+	po := originFromBiz(o)
+	po.ID = 0
+	if err := repo.db.WithContext(ctx).Create(po).Error; err != nil {
+		return originWriteError(err, o.Host)
+	}
+	*o = *po.toBiz()
+	return nil
+}
+
+func (repo *sqlOriginRepo) Update(ctx context.Context, o *biz.Origin) error {
+	item, err := originItemOf(o)
+	if err != nil {
+		return err
+	}
+	o.Host = item.Host
+	po := originFromBiz(o)
+	return repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&OriginPO{}).Where("id = ?", o.ID).Updates(map[string]any{
+			"host":        po.Host,
+			"name":        po.Name,
+			"icon":        po.Icon,
+			"canonical":   po.Canonical,
+			"content_ids": po.ContentIDs,
+			"share_text":  po.ShareText,
+			"updated_at":  time.Now(),
+		})
+		if res.Error != nil {
+			return originWriteError(res.Error, o.Host)
+		}
+		if res.RowsAffected == 0 {
+			return biz.ErrNotFound.WithMessage("origin " + strconv.FormatInt(o.ID, 10))
+		}
+		var saved OriginPO
+		if err := tx.Where("id = ?", o.ID).First(&saved).Error; err != nil {
+			return wrapQueryError(err)
+		}
+		*o = *saved.toBiz()
+		return nil
+	})
+}
+
+func (repo *sqlOriginRepo) Delete(ctx context.Context, id int64) error {
+	res := repo.db.WithContext(ctx).Where("id = ?", id).Delete(&OriginPO{})
+	if res.Error != nil {
+		return wrapQueryError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return biz.ErrNotFound.WithMessage("origin " + strconv.FormatInt(id, 10))
+	}
+	return nil
+}
+
+func (repo *sqlOriginRepo) Seed(ctx context.Context, origins []*biz.Origin) (int, error) {
+	pos := make([]*OriginPO, len(origins))
+	hosts := make([]string, len(origins))
+	for i, o := range origins {
+		item, err := originItemOf(o)
+		if err != nil {
+			return 0, err
+		}
+		o.Host = item.Host
+		pos[i], hosts[i] = originFromBiz(o), o.Host
+	}
+	added := 0
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var seeded, taken []string
+		if err := tx.Model(&OriginSeedPO{}).Where("host IN ?", hosts).Pluck("host", &seeded).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&OriginPO{}).Where("host IN ?", hosts).Pluck("host", &taken).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, po := range pos {
+			if slices.Contains(seeded, po.Host) {
+				continue
+			}
+			seeded = append(seeded, po.Host)
+			if err := tx.Create(&OriginSeedPO{Host: po.Host, SeededAt: now}).Error; err != nil {
+				return err
+			}
+			if slices.Contains(taken, po.Host) {
+				continue
+			}
+			po.ID = 0
+			if err := tx.Create(po).Error; err != nil {
+				return err
+			}
+			added++
+		}
+		return nil
+	})
+	// another instance seeding at the same time got there first
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, wrapQueryError(err)
+	}
+	return added, nil
+}
+
+// originWriteError names the host a unique-key violation is about.
+func originWriteError(err error, host string) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return biz.ErrConflict.WithMessage("origin host " + host + " already exists")
+	}
+	return wrapQueryError(err)
+}
+
+type memoryOriginRepo struct {
+	mu     sync.RWMutex
+	byID   map[int64]*biz.Origin
+	seeded map[string]bool
+	lastID int64
+}
+
+// NewMemoryOriginRepo keeps origins in process memory; they are lost on exit.
+func NewMemoryOriginRepo() biz.OriginRepo {
+	return &memoryOriginRepo{byID: make(map[int64]*biz.Origin), seeded: make(map[string]bool)}
+}
+
+func (repo *memoryOriginRepo) List(ctx context.Context) ([]*biz.Origin, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	origins := make([]*biz.Origin, 0, len(repo.byID))
+	for _, o := range repo.byID {
+		cp := *o
+		origins = append(origins, &cp)
+	}
+	slices.SortFunc(origins, func(a, b *biz.Origin) int { return strings.Compare(a.Host, b.Host) })
+	return origins, nil
+}
+
+func (repo *memoryOriginRepo) Get(ctx context.Context, id int64) (*biz.Origin, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	o, ok := repo.byID[id]
+	if !ok {
+		return nil, biz.ErrNotFound.WithMessage("origin " + strconv.FormatInt(id, 10))
+	}
+	cp := *o
+	return &cp, nil
+}
+
+func (repo *memoryOriginRepo) Create(ctx context.Context, o *biz.Origin) error {
+	item, err := originItemOf(o)
+	if err != nil {
+		return err
+	}
+	o.Host = item.Host
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if err := repo.checkHost(0, o.Host); err != nil {
+		return err
+	}
+	repo.lastID++
+	now := time.Now()
+	*o = *originFromBiz(o).toBiz()
+	o.ID, o.CreatedAt, o.UpdatedAt = repo.lastID, now, now
+	cp := *o
+	repo.byID[o.ID] = &cp
+	return nil
+}
+
+func (repo *memoryOriginRepo) Update(ctx context.Context, o *biz.Origin) error {
+	item, err := originItemOf(o)
+	if err != nil {
+		return err
+	}
+	o.Host = item.Host
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	old, ok := repo.byID[o.ID]
+	if !ok {
+		return biz.ErrNotFound.WithMessage("origin " + strconv.FormatInt(o.ID, 10))
+	}
+	if err := repo.checkHost(o.ID, o.Host); err != nil {
+		return err
+	}
+	*o = *originFromBiz(o).toBiz()
+	o.CreatedAt, o.UpdatedAt = old.CreatedAt, time.Now()
+	cp := *o
+	repo.byID[o.ID] = &cp
+	return nil
+}
+
+func (repo *memoryOriginRepo) Delete(ctx context.Context, id int64) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if _, ok := repo.byID[id]; !ok {
+		return biz.ErrNotFound.WithMessage("origin " + strconv.FormatInt(id, 10))
+	}
+	delete(repo.byID, id)
+	return nil
+}
+
+func (repo *memoryOriginRepo) Seed(ctx context.Context, origins []*biz.Origin) (int, error) {
+	for _, o := range origins {
+		item, err := originItemOf(o)
+		if err != nil {
+			return 0, err
+		}
+		o.Host = item.Host
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	added := 0
+	now := time.Now()
+	for _, o := range origins {
+		if repo.seeded[o.Host] {
+			continue
+		}
+		repo.seeded[o.Host] = true
+		if repo.checkHost(0, o.Host) != nil {
+			continue
+		}
+		repo.lastID++
+		cp := *originFromBiz(o).toBiz()
+		cp.ID, cp.CreatedAt, cp.UpdatedAt = repo.lastID, now, now
+		repo.byID[cp.ID] = &cp
+		added++
+	}
+	return added, nil
+}
+
+// checkHost reports a conflict when an origin other than id has host.
+func (repo *memoryOriginRepo) checkHost(id int64, host string) error {
+	for _, o := range repo.byID {
+		if o.ID != id && o.Host == host {
+			return biz.ErrConflict.WithMessage("origin host " + host + " already exists")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package data
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// canonicalRule describes how a URL of one origin is reduced to its canonical
+// form. Query names ending in "*" match by prefix (e.g. "utm_*").
+type canonicalRule struct {
+	// DropQuery lists query parameters removed from the canonical URL.
+	DropQuery []string `json:"drop_query,omitempty"`
+	// KeepQuery, when non-empty, is a whitelist: every other parameter is dropped.
+	KeepQuery []string `json:"keep_query,omitempty"`
+	// TrailingSlash is "keep" (default), "strip" or "add".
+	TrailingSlash string `json:"trailing_slash,omitempty"`
+}
+
+const (
+	trailingSlashKeep  = "keep"
+	trailingSlashStrip = "strip"
+	trailingSlashAdd   = "add"
+)
+
+// merge layers an item rule on top of the default rule.
+func (r canonicalRule) merge(item *canonicalRule) canonicalRule {
+	if item == nil {
+		return r
+	}
+	out := canonicalRule{
+		DropQuery:     append(append([]string{}, r.DropQuery...), item.DropQuery...),
+		KeepQuery:     r.KeepQuery,
+		TrailingSlash: r.TrailingSlash,
+	}
+	if len(item.KeepQuery) > 0 {
+		out.KeepQuery = item.KeepQuery
+	}
+	if item.TrailingSlash != "" {
+		out.TrailingSlash = item.TrailingSlash
+	}
+	return out
+}
+
+func (r canonicalRule) validate() error {
+	switch r.TrailingSlash {
+	case "", trailingSlashKeep, trailingSlashStrip, trailingSlashAdd:
+		return nil
+	default:
+		return fmt.Errorf("invalid trailing_slash policy: %q", r.TrailingSlash)
+	}
+}
+
+// matchQueryName reports whether name matches any of the patterns.
+func matchQueryName(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// apply rewrites u into its canonical form: https scheme, lower-case host
+// without "www.", no fragment, filtered and sorted query, and the configured
+// trailing-slash policy.
+func (r canonicalRule) apply(u *url.URL) string {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+
+	path := u.EscapedPath()
+	switch r.TrailingSlash {
+	case trailingSlashStrip:
+		path = strings.TrimRight(path, "/")
+	case trailingSlashAdd:
+		if !strings.HasSuffix(path, "/") {
+			path += "/"
+		}
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	query := u.Query()
+	for name := range query {
+		if len(r.KeepQuery) > 0 && !matchQueryName(r.KeepQuery, name) {
+			query.Del(name)
+			continue
+		}
+		if matchQueryName(r.DropQuery, name) {
+			query.Del(name)
+		}
+	}
+
+	canonical := "https://" + host + path
+	if encoded := query.Encode(); encoded != "" {
+		canonical += "?" + encoded
+	}
+	return canonical
+}
+
+// contentIDRule extracts an origin-specific item identifier (a Bilibili BV id,
+// a Zhihu question id, a JD sku id) from the canonical URL. Pattern must have
+// a named capture group "id".
+type contentIDRule struct {
+	Type    string `json:"type"`
+	Pattern string `json:"pattern"`
+
+	re    *regexp.Regexp
+	group int
+}
+
+func (r *contentIDRule) compile() error {
+	if r.Type == "" {
+		return fmt.Errorf("content id rule %q is missing a type", r.Pattern)
+	}
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return err
+	}
+	group := re.SubexpIndex("id")
+	if group < 0 {
+		return fmt.Errorf("content id pattern %q has no (?P<id>...) group", r.Pattern)
+	}
+	r.re, r.group = re, group
+	return nil
+}
+
+// match returns the captured id, if any.
+func (r contentIDRule) match(s string) (string, bool) {
+	if r.re == nil {
+		return "", false
+	}
+	m := r.re.FindStringSubmatch(s)
+	if m == nil || m[r.group] == "" {
+		return "", false
+	}
+	return m[r.group], true
+}
+
+// shareTextRule pulls a title out of an app's share text, e.g.
+// "【标题】 https://b23.tv/xxx". Pattern must have a named group "title".
+type shareTextRule struct {
+	Pattern string `json:"pattern"`
+
+	re    *regexp.Regexp
+	group int
+}
+
+func (r *shareTextRule) compile() error {
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return err
+	}
+	group := re.SubexpIndex("title")
+	if group < 0 {
+		return fmt.Errorf("share text pattern %q has no (?P<title>...) group", r.Pattern)
+	}
+	r.re, r.group = re, group
+	return nil
+}
+
+// match returns the trimmed title, if any.
+func (r shareTextRule) match(s string) (string, bool) {
+	if r.re == nil {
+		return "", false
+	}
+	m := r.re.FindStringSubmatch(s)
+	if m == nil {
+		return "", false
+	}
+	title := strings.TrimSpace(m[r.group])
+	return title, title != ""
+}
@@ -0,0 +1,42 @@
+package data
+
+import (
+	"github/heimaolst/collectionbox/internal/biz"
+
+	"gorm.io/gorm"
+)
+
+// pageScope applies keyset pagination over (created_at, id). It fetches one
+// extra row so toPage can tell whether another page exists.
+func pageScope(page biz.PageRequest, asc bool) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		cur, err := biz.DecodeCursor(page.Cursor)
+		if err != nil {
+			db.AddError(err)
+			return db
+		}
+		op, dir := "<", "DESC"
+		if asc {
+			op, dir = ">", "ASC"
+		}
+		if cur != nil {
+			db = db.Where("(collection_pos.created_at "+op+" ? OR (collection_pos.created_at = ? AND collection_pos.id "+op+" ?))",
+				cur.CreatedAt, cur.CreatedAt, cur.ID)
+		}
+		return db.Order("collection_pos.created_at " + dir + ", collection_pos.id " + dir).
+			Limit(page.Limit + 1)
+	}
+}
+
+// toPage trims the look-ahead row fetched by pageScope and sets NextCursor.
+func toPage(pos []*CollectionPO, limit int) *biz.Page {
+	page := &biz.Page{Items: make([]*biz.Collection, 0, min(len(pos), limit))}
+	for i, po := range pos {
+		if i == limit {
+			page.NextCursor = biz.CursorAfter(page.Items[limit-1])
+			break
+		}
+		page.Items = append(page.Items, po.toBiz())
+	}
+	return page
+}
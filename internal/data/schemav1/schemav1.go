@@ -0,0 +1,40 @@
+// Package schemav1 freezes the tables of schema version 1, the layout
+// AutoMigrate used to manage before migrations were versioned. The type
+// names match the original PO structs because gorm derives constraint names
+// from them. URL and TagPO.Name carry a size AutoMigrate never had, without
+// which MySQL can't index them; SQLite ignores it.
+package schemav1
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type CollectionPO struct {
+	ID          string
+	CreatedAt   time.Time
+	URL         string `gorm:"size:768;uniqueIndex"`
+	RawURL      string
+	Origin      string `gorm:"index:idx_collection_content,priority:1"`
+	ContentType string `gorm:"index:idx_collection_content,priority:2"`
+	ContentID   string `gorm:"index:idx_collection_content,priority:3"`
+	Title       string
+	Note        string
+	Status      string `gorm:"index;default:unread"`
+	ReadAt      *time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+	Tags        []TagPO        `gorm:"many2many:collection_tags;joinForeignKey:CollectionID;joinReferences:TagID"`
+}
+
+type TagPO struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"size:64;uniqueIndex"`
+	CreatedAt time.Time
+}
+
+type ShortLinkPO struct {
+	ShortURL  string `gorm:"primaryKey"`
+	TargetURL string
+	CreatedAt time.Time
+}
@@ -0,0 +1,23 @@
+// Package schemav2 freezes what schema version 2 adds: save bookkeeping on
+// collection_pos and the collection_events log.
+package schemav2
+
+import "time"
+
+// CollectionPO holds only the columns v2 adds to collection_pos.
+type CollectionPO struct {
+	ID          string
+	SaveCount   int64 `gorm:"not null;default:0"`
+	LastSavedAt *time.Time
+}
+
+type CollectionEventPO struct {
+	ID           int64     `gorm:"primaryKey"`
+	CollectionID string    `gorm:"size:64;index:idx_collection_events_collection,priority:1"`
+	SavedAt      time.Time `gorm:"index:idx_collection_events_collection,priority:2"`
+	SourceHash   string    `gorm:"size:64"`
+	Client       string    `gorm:"size:200"`
+	RequestID    string    `gorm:"size:64"`
+}
+
+func (CollectionEventPO) TableName() string { return "collection_events" }
@@ -0,0 +1,27 @@
+// Package schemav3 freezes what schema version 3 adds: the origins table,
+// which replaces the items of origin.json, and origin_seeds, the hosts ever
+// seeded from that file.
+package schemav3
+
+import "time"
+
+type OriginPO struct {
+	ID         int64  `gorm:"primaryKey"`
+	Host       string `gorm:"size:255;not null;uniqueIndex"`
+	Name       string `gorm:"size:255;not null"`
+	Icon       string `gorm:"type:text"`
+	Canonical  string `gorm:"type:text"`
+	ContentIDs string `gorm:"type:text"`
+	ShareText  string `gorm:"type:text"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (OriginPO) TableName() string { return "origins" }
+
+type OriginSeedPO struct {
+	Host     string `gorm:"primaryKey;size:255"`
+	SeededAt time.Time
+}
+
+func (OriginSeedPO) TableName() string { return "origin_seeds" }
@@ -0,0 +1,232 @@
+package data
+
+import (
+	"context"
+	"html"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github/heimaolst/collectionbox/internal/biz"
+
+	"gorm.io/gorm"
+)
+
+// ftsReady reports whether Search can use the collection_fts index: the
+// v4 migration created it and the driver has FTS5 (SQLite built with
+// -tags sqlite_fts5).
+func ftsReady(db *gorm.DB) bool {
+	if db.Dialector.Name() != "sqlite" || !sqliteHasFTS5(db) {
+		return false
+	}
+	var n int64
+	db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'collection_fts'").Scan(&n)
+	return n > 0
+}
+
+func sqliteHasFTS5(db *gorm.DB) bool {
+	var used int
+	return db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used).Error == nil && used == 1
+}
+
+// minTrigramRunes is the shortest term the trigram index can match.
+const minTrigramRunes = 3
+
+const (
+	snippetOpen  = "<mark>"
+	snippetClose = "</mark>"
+
+	// FTS5 brackets matches with these private-use runes, so the snippet can
+	// be HTML-escaped before they turn into <mark> tags.
+	ftsOpen  = "\ue000"
+	ftsClose = "\ue001"
+)
+
+// ftsSnippetHTML escapes an FTS5 snippet and turns its match brackets into
+// <mark> tags.
+func ftsSnippetHTML(s string) string {
+	s = html.EscapeString(s)
+	return strings.NewReplacer(ftsOpen, snippetOpen, ftsClose, snippetClose).Replace(s)
+}
+
+func (repo *sqlRepo) Search(ctx context.Context, q biz.SearchQuery, limit int) ([]*biz.SearchResult, error) {
+	useFTS := repo.fts && len(q.Terms) > 0
+	for _, t := range q.Terms {
+		if utf8.RuneCountInString(t) < minTrigramRunes {
+			useFTS = false
+		}
+	}
+	if useFTS {
+		return repo.searchFTS(ctx, q, limit)
+	}
+	return repo.searchLike(ctx, q, limit)
+}
+
+// searchFilters applies the origin:/tag: parts of q.
+func searchFilters(q biz.SearchQuery) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(q.Origins) > 0 {
+			origins := make([]string, 0, len(q.Origins))
+			for _, o := range q.Origins {
+				origins = append(origins, strings.ToLower(o))
+			}
+			db = db.Where("LOWER(collection_pos.origin) IN ?", origins)
+		}
+		return db.Scopes(tagScope(biz.TagFilter{Tags: q.Tags, MatchAll: true}))
+	}
+}
+
+// ftsMatchExpr quotes every term so FTS5 operators in user input are inert;
+// a quoted term with spaces is a phrase, and adjacent terms are ANDed.
+func ftsMatchExpr(terms []string) string {
+	quoted := make([]string, 0, len(terms))
+	for _, t := range terms {
+		quoted = append(quoted, `"`+strings.ReplaceAll(t, `"`, `""`)+`"`)
+	}
+	return "{url title note} : (" + strings.Join(quoted, " ") + ")"
+}
+
+func (repo *sqlRepo) searchFTS(ctx context.Context, q biz.SearchQuery, limit int) ([]*biz.SearchResult, error) {
+	var hits []struct {
+		ID      string
+		Snippet string
+		Rank    float64
+	}
+	err := repo.db.WithContext(ctx).Model(&CollectionPO{}).
+		Select("collection_pos.id AS id, "+
+			"snippet(collection_fts, -1, ?, ?, '…', 16) AS snippet, "+
+			"bm25(collection_fts, 0, 1.0, 5.0, 2.0) AS rank", ftsOpen, ftsClose).
+		Joins("JOIN collection_fts ON collection_fts.id = collection_pos.id").
+		Where("collection_fts MATCH ?", ftsMatchExpr(q.Terms)).
+		Scopes(searchFilters(q)).
+		Order("rank").
+		Limit(limit).
+		Scan(&hits).Error
+	if err != nil {
+		return nil, biz.ErrInternalError.WithMessage(err.Error())
+	}
+	if len(hits) == 0 {
+		return []*biz.SearchResult{}, nil
+	}
+
+	ids := make([]string, 0, len(hits))
+	for _, h := range hits {
+		ids = append(ids, h.ID)
+	}
+	var pos []*CollectionPO
+	if err := repo.db.WithContext(ctx).Scopes(withTags).Where("id IN ?", ids).Find(&pos).Error; err != nil {
+		return nil, biz.ErrInternalError.WithMessage(err.Error())
+	}
+	byID := make(map[string]*CollectionPO, len(pos))
+	for _, po := range pos {
+		byID[po.ID] = po
+	}
+
+	results := make([]*biz.SearchResult, 0, len(hits))
+	for _, h := range hits {
+		if po, ok := byID[h.ID]; ok {
+			results = append(results, &biz.SearchResult{Collection: po.toBiz(), Snippet: ftsSnippetHTML(h.Snippet), Rank: h.Rank})
+		}
+	}
+	return results, nil
+}
+
+// searchLike is the portable fallback: every term must appear in url, title
+// or note. Results are ranked by how many fields match, then by recency.
+func (repo *sqlRepo) searchLike(ctx context.Context, q biz.SearchQuery, limit int) ([]*biz.SearchResult, error) {
+	query := repo.db.WithContext(ctx).Scopes(withTags, searchFilters(q))
+	for _, t := range q.Terms {
+		// LOWER on both sides: LIKE is case-sensitive on PostgreSQL
+		pattern := "%" + escapeLike(strings.ToLower(t)) + "%"
+		query = query.Where("(LOWER(collection_pos.url) LIKE ? ESCAPE '!' OR LOWER(collection_pos.title) LIKE ? ESCAPE '!' OR LOWER(collection_pos.note) LIKE ? ESCAPE '!')",
+			pattern, pattern, pattern)
+	}
+	var pos []*CollectionPO
+	if err := query.Order("collection_pos.created_at DESC").Limit(limit).Find(&pos).Error; err != nil {
+		return nil, biz.ErrInternalError.WithMessage(err.Error())
+	}
+
+	results := make([]*biz.SearchResult, 0, len(pos))
+	for _, po := range pos {
+		snippet, hits := likeSnippet(po, q.Terms)
+		results = append(results, &biz.SearchResult{Collection: po.toBiz(), Snippet: snippet, Rank: -float64(hits)})
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Rank < results[j].Rank })
+	return results, nil
+}
+
+// escapeLike uses ! as the escape character: a backslash would need
+// different quoting on MySQL than everywhere else.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`).Replace(s)
+}
+
+// likeSnippet highlights terms in the first of title, note, url that
+// contains one, and counts matching fields for ranking.
+func likeSnippet(po *CollectionPO, terms []string) (string, int) {
+	snippet, hits := "", 0
+	for _, field := range []string{po.Title, po.Note, po.URL} {
+		lower := strings.ToLower(field)
+		matched := false
+		for _, t := range terms {
+			if strings.Contains(lower, strings.ToLower(t)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		hits++
+		if snippet == "" {
+			snippet = highlight(field, terms)
+		}
+	}
+	if snippet == "" {
+		snippet = html.EscapeString(po.Title)
+	}
+	return snippet, hits
+}
+
+// highlight HTML-escapes s and wraps case-insensitive occurrences of terms
+// in <mark>.
+func highlight(s string, terms []string) string {
+	lower := strings.ToLower(s)
+	if len(lower) != len(s) {
+		return html.EscapeString(s)
+	}
+	marked := make([]bool, len(s))
+	for _, t := range terms {
+		lt := strings.ToLower(t)
+		if lt == "" || len(lt) != len(t) {
+			// case folding changed byte length; skip rather than misalign
+			continue
+		}
+		for i := 0; ; {
+			j := strings.Index(lower[i:], lt)
+			if j < 0 {
+				break
+			}
+			for k := i + j; k < i+j+len(lt); k++ {
+				marked[k] = true
+			}
+			i += j + len(lt)
+		}
+	}
+	// escape each run of marked or unmarked bytes on its own so the tags
+	// never land inside an entity
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		j := i + 1
+		for j < len(s) && marked[j] == marked[i] {
+			j++
+		}
+		if marked[i] {
+			b.WriteString(snippetOpen + html.EscapeString(s[i:j]) + snippetClose)
+		} else {
+			b.WriteString(html.EscapeString(s[i:j]))
+		}
+		i = j
+	}
+	return b.String()
+}
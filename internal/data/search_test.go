@@ -0,0 +1,72 @@
+package data
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/biz"
+)
+
+// Runs against FTS5 when built with -tags sqlite_fts5 and against the LIKE
+// fallback otherwise; both must agree on what matches.
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	repo := NewSQLRepo(newTestDB(t))
+	seed := []*biz.Collection{
+		{ID: "1", URL: "https://zhihu.com/question/11", Origin: "Zhihu", Title: "关于 gorm 软删除的回答"},
+		{ID: "2", URL: "https://bilibili.com/video/BV1xx411c7mD", Origin: "Bilibili", Title: "Go 并发入门"},
+		{ID: "3", URL: "https://jd.com/100.html", Origin: "JD", Title: "机械键盘"},
+	}
+	for _, c := range seed {
+		c.CreatedAt = time.Now()
+		c.Status = biz.StatusUnread
+		if _, err := repo.UpsertCollection(ctx, c, biz.CollectionEvent{}); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	note := "讲了 gorm 的 hooks"
+	col, _ := repo.GetByID(ctx, "2")
+	col.Note = note
+	if err := repo.Update(ctx, col); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := repo.AddTags(ctx, "2", []string{"go"}); err != nil {
+		t.Fatalf("add tags: %v", err)
+	}
+
+	cases := []struct {
+		q    string
+		want []string
+	}{
+		{"gorm", []string{"1", "2"}},
+		{`"软删除的回答"`, []string{"1"}},
+		{"gorm origin:zhihu", []string{"1"}},
+		{"gorm tag:go", []string{"2"}},
+		{"键盘", []string{"3"}},
+		{"nothing-like-this", nil},
+	}
+	for _, c := range cases {
+		sq, err := biz.ParseSearchQuery(c.q)
+		if err != nil {
+			t.Fatalf("parse %q: %v", c.q, err)
+		}
+		results, err := repo.Search(ctx, sq, 10)
+		if err != nil {
+			t.Fatalf("search %q: %v", c.q, err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.ID)
+			if len(c.want) > 0 && !strings.Contains(r.Snippet, snippetOpen) {
+				t.Errorf("search %q: snippet %q has no highlight", c.q, r.Snippet)
+			}
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, c.want) {
+			t.Errorf("search %q: got %v, want %v", c.q, got, c.want)
+		}
+	}
+}
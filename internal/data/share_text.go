@@ -0,0 +1,46 @@
+package data
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// maxTitleRunes bounds titles guessed from free-form text.
+const maxTitleRunes = 120
+
+// shareTextContext returns the text belonging to span: segment runs from the
+// end of the previous link to the start of the next one, before stops at the
+// link itself. Spans overlapping span (the same link matched twice) are ignored.
+func shareTextContext(text string, spans [][2]int, span [2]int) (segment, before string) {
+	prevEnd, nextStart := 0, len(text)
+	for _, s := range spans {
+		if s[1] <= span[0] && s[1] > prevEnd {
+			prevEnd = s[1]
+		}
+		if s[0] >= span[1] && s[0] < nextStart {
+			nextStart = s[0]
+		}
+	}
+	return text[prevEnd:nextStart], text[prevEnd:span[0]]
+}
+
+// guessTitle is the fallback when no share_text pattern matches: it uses the
+// last line before the link, preferring the content of a 【...】 pair.
+func guessTitle(before string) string {
+	before = strings.TrimSpace(before)
+	if i := strings.LastIndexByte(before, '\n'); i >= 0 {
+		before = strings.TrimSpace(before[i+1:])
+	}
+	if end := strings.LastIndex(before, "】"); end >= 0 {
+		if start := strings.LastIndex(before[:end], "【"); start >= 0 {
+			before = before[start+len("【") : end]
+		}
+	}
+	title := strings.TrimFunc(before, func(r rune) bool {
+		return strings.ContainsRune(" \t\r\n:：-|｜,，。", r)
+	})
+	if utf8.RuneCountInString(title) > maxTitleRunes {
+		title = string([]rune(title)[:maxTitleRunes])
+	}
+	return title
+}
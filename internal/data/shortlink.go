@@ -0,0 +1,213 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/logx"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ShortLinkResolver expands redirector links such as b23.tv/xxxx or t.cn/xxxx
+// into the URL they point to.
+type ShortLinkResolver interface {
+	Resolve(ctx context.Context, shortURL string) (string, error)
+}
+
+// ShortLinkPO caches a resolved short link.
+type ShortLinkPO struct {
+	ShortURL  string `gorm:"primaryKey"`
+	TargetURL string
+	CreatedAt time.Time
+}
+
+// httpShortLinkResolver follows redirects one hop at a time so the hop count
+// is bounded and the final destination is never downloaded.
+type httpShortLinkResolver struct {
+	db      *gorm.DB
+	client  *http.Client
+	maxHops int
+	timeout time.Duration
+}
+
+// NewShortLinkResolver returns a resolver that follows at most maxHops
+// redirects within timeout. Results are cached in db; a nil db disables the cache.
+// Every hop must land on a public address, so a redirect can't point the
+// server at itself or its network.
+func NewShortLinkResolver(db *gorm.DB, maxHops int, timeout time.Duration) ShortLinkResolver {
+	return newShortLinkResolver(db, maxHops, timeout, publicAddressOnly)
+}
+
+// newShortLinkResolver checks every connection with control; nil allows any
+// address, which tests need to reach httptest servers.
+func newShortLinkResolver(db *gorm.DB, maxHops int, timeout time.Duration, control func(network, address string, c syscall.RawConn) error) *httpShortLinkResolver {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// no proxy: the address check has to see the real destination
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{Timeout: timeout, Control: control}).DialContext
+	return &httpShortLinkResolver{
+		db: db,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		maxHops: maxHops,
+		timeout: timeout,
+	}
+}
+
+var errNonPublicAddress = errors.New("short link points at a non-public address")
+
+// publicAddressOnly is a net.Dialer Control hook: it runs on the resolved IP
+// of each connection, so neither a Location header nor a DNS answer can
+// reach loopback, private or link-local addresses.
+func publicAddressOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if ip = ip.Unmap(); !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return fmt.Errorf("%w: %s", errNonPublicAddress, ip)
+	}
+	return nil
+}
+
+// maxShortLinkKey is as long a key as the short_url column holds on MySQL,
+// where gorm sizes an unsized string primary key to 191; longer links are
+// resolved every time rather than cached under a truncated key.
+const maxShortLinkKey = 191
+
+// shortLinkKey drops scheme and fragment but keeps the query: some
+// redirectors tell links apart by query alone.
+func shortLinkKey(u *url.URL) string {
+	key := strings.ToLower(u.Host) + u.EscapedPath()
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key
+}
+
+func (r *httpShortLinkResolver) Resolve(ctx context.Context, shortURL string) (string, error) {
+	if !strings.Contains(shortURL, "://") {
+		shortURL = "https://" + strings.TrimPrefix(shortURL, "//")
+	}
+	current, err := url.Parse(shortURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid short link: %w", err)
+	}
+	key := shortLinkKey(current)
+
+	if target, ok := r.lookup(ctx, key); ok {
+		return target, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	for hop := 0; ; hop++ {
+		next, redirected, err := r.step(ctx, current)
+		if err != nil {
+			return "", err
+		}
+		if !redirected {
+			break
+		}
+		if hop >= r.maxHops {
+			return "", fmt.Errorf("short link %s: more than %d redirects", shortURL, r.maxHops)
+		}
+		current = next
+	}
+
+	target := current.String()
+	r.store(ctx, key, target)
+	return target, nil
+}
+
+// step issues a single request and reports the redirect target, if any.
+// HEAD is tried first; redirectors that refuse it get a GET.
+func (r *httpShortLinkResolver) step(ctx context.Context, u *url.URL) (*url.URL, bool, error) {
+	resp, err := r.do(ctx, http.MethodHead, u)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp, err = r.do(ctx, http.MethodGet, u)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("resolve short link %s: %w", u, err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return u, false, nil
+	}
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return nil, false, fmt.Errorf("resolve short link %s: redirect without Location", u)
+	}
+	next, err := u.Parse(loc)
+	if err != nil {
+		return nil, false, fmt.Errorf("resolve short link %s: bad Location %q: %w", u, loc, err)
+	}
+	if next.Scheme != "http" && next.Scheme != "https" {
+		return nil, false, fmt.Errorf("resolve short link %s: redirect to %s URL", u, next.Scheme)
+	}
+	return next, true, nil
+}
+
+func (r *httpShortLinkResolver) do(ctx context.Context, method string, u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+func (r *httpShortLinkResolver) lookup(ctx context.Context, key string) (string, bool) {
+	if r.db == nil || len(key) > maxShortLinkKey {
+		return "", false
+	}
+	var po ShortLinkPO
+	err := r.db.WithContext(ctx).Where("short_url = ?", key).First(&po).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logx.FromContext(ctx).Warn("short link cache lookup failed", "key", key, "err", err)
+		}
+		return "", false
+	}
+	return po.TargetURL, true
+}
+
+func (r *httpShortLinkResolver) store(ctx context.Context, key, target string) {
+	if r.db == nil || len(key) > maxShortLinkKey {
+		return
+	}
+	po := ShortLinkPO{ShortURL: key, TargetURL: target, CreatedAt: time.Now()}
+	err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&po).Error
+	if err != nil {
+		logx.FromContext(ctx).Warn("short link cache store failed", "key", key, "err", err)
+	}
+}
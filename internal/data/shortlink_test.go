@@ -0,0 +1,184 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := Open("sqlite://"+filepath.Join(t.TempDir(), "test.db"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := MigrateUp(context.Background(), db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// newRedirectServer serves /s/N -> /s/N-1 -> ... -> /s/0 -> /video/BV1xx411c7mD.
+func newRedirectServer(t *testing.T, hits *int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*hits++
+		if r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/nohead/") {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		switch r.URL.Path {
+		case "/s/3":
+			http.Redirect(w, r, "/s/2", http.StatusFound)
+		case "/s/2":
+			http.Redirect(w, r, "/s/1", http.StatusMovedPermanently)
+		case "/s/1", "/nohead/1":
+			http.Redirect(w, r, "/video/BV1xx411c7mD?share_source=copy", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestShortLinkResolver_FollowsRedirectsAndCaches(t *testing.T) {
+	hits := 0
+	srv := newRedirectServer(t, &hits)
+	r := newShortLinkResolver(newTestDB(t), 5, time.Second, nil)
+
+	got, err := r.Resolve(context.Background(), srv.URL+"/s/3?from=share")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := srv.URL + "/video/BV1xx411c7mD?share_source=copy"
+	if got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	before := hits
+	got, err = r.Resolve(context.Background(), srv.URL+"/s/3?from=share#top")
+	if err != nil {
+		t.Fatalf("cached resolve: %v", err)
+	}
+	if got != want || hits != before {
+		t.Fatalf("expected cache hit: got %s, extra hits %d", got, hits-before)
+	}
+
+	// the query is part of the key
+	if _, err := r.Resolve(context.Background(), srv.URL+"/s/3?from=feed"); err != nil {
+		t.Fatalf("resolve with another query: %v", err)
+	}
+	if hits == before {
+		t.Fatal("a different query was served from the cache")
+	}
+}
+
+func TestShortLinkResolver_RefusesNonPublicAddresses(t *testing.T) {
+	hits := 0
+	internal := newRedirectServer(t, &hits)
+	// stands in for a public redirector that sends the second hop inside
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL+"/s/1", http.StatusFound)
+	}))
+	t.Cleanup(redirector.Close)
+	redirectorAddr := strings.TrimPrefix(redirector.URL, "http://")
+	control := func(network, address string, c syscall.RawConn) error {
+		if address == redirectorAddr {
+			return nil
+		}
+		return publicAddressOnly(network, address, c)
+	}
+	r := newShortLinkResolver(nil, 5, time.Second, control)
+
+	if _, err := r.Resolve(context.Background(), redirector.URL+"/s"); !errors.Is(err, errNonPublicAddress) {
+		t.Fatalf("redirect to loopback: got %v, want errNonPublicAddress", err)
+	}
+	if hits != 0 {
+		t.Fatalf("internal server was hit %d times", hits)
+	}
+	if _, err := NewShortLinkResolver(nil, 5, time.Second).Resolve(context.Background(), internal.URL+"/s/1"); !errors.Is(err, errNonPublicAddress) {
+		t.Fatalf("loopback short link: got %v, want errNonPublicAddress", err)
+	}
+}
+
+func TestPublicAddressOnly(t *testing.T) {
+	for addr, public := range map[string]bool{
+		"8.8.8.8:443":                true,
+		"[2606:4700:4700::1111]:443": true,
+		"127.0.0.1:80":               false,
+		"[::1]:80":                   false,
+		"[::ffff:127.0.0.1]:80":      false,
+		"10.1.2.3:80":                false,
+		"172.16.0.1:80":              false,
+		"192.168.1.1:80":             false,
+		"169.254.169.254:80":         false,
+		"[fe80::1]:80":               false,
+		"[fd00::1]:80":               false,
+		"0.0.0.0:80":                 false,
+		"224.0.0.1:80":               false,
+	} {
+		if err := publicAddressOnly("tcp", addr, nil); (err == nil) != public {
+			t.Errorf("%s: got %v, want public=%v", addr, err, public)
+		}
+	}
+}
+
+func TestShortLinkResolver_HopLimit(t *testing.T) {
+	hits := 0
+	srv := newRedirectServer(t, &hits)
+	r := newShortLinkResolver(nil, 2, time.Second, nil)
+
+	if _, err := r.Resolve(context.Background(), srv.URL+"/s/3"); err == nil {
+		t.Fatal("expected hop limit error")
+	}
+}
+
+func TestShortLinkResolver_FallsBackToGET(t *testing.T) {
+	hits := 0
+	srv := newRedirectServer(t, &hits)
+	r := newShortLinkResolver(nil, 5, time.Second, nil)
+
+	got, err := r.Resolve(context.Background(), srv.URL+"/nohead/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(got, "/video/BV1xx411c7mD?share_source=copy") {
+		t.Fatalf("unexpected target %s", got)
+	}
+}
+
+type stubResolver map[string]string
+
+func (s stubResolver) Resolve(_ context.Context, shortURL string) (string, error) {
+	return s[shortURL], nil
+}
+
+func TestExtractAll_ResolvesShortLinks(t *testing.T) {
+	extractor := newTestExtractor()
+	extractor.shortHosts = map[string]struct{}{"b23.tv": {}}
+	extractor.resolver = stubResolver{
+		"https://b23.tv/abcd": "https://www.bilibili.com/video/BV1xx411c7mD?share_source=copy",
+		"b23.tv/abcd":         "https://www.bilibili.com/video/BV1xx411c7mD?share_source=copy",
+	}
+
+	pairs, err := extractor.ExtractAll(context.Background(), "【标题】 https://b23.tv/abcd")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pairs) != 1 {
+		t.Fatalf("expected 1 pair, got %d: %+v", len(pairs), pairs)
+	}
+	if pairs[0].Origin != "Bilibili" || pairs[0].URL != "https://b23.tv/abcd" {
+		t.Fatalf("unexpected pair %+v", pairs[0])
+	}
+}
@@ -0,0 +1,58 @@
+package data
+
+import (
+	"context"
+
+	"github/heimaolst/collectionbox/internal/biz"
+
+	"gorm.io/gorm"
+)
+
+// streamBatchSize is how many rows Stream holds in memory at a time.
+const streamBatchSize = 500
+
+func filterScope(f biz.CollectionFilter) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if f.Origin != "" {
+			db = db.Where("collection_pos.origin = ?", f.Origin)
+		}
+		if f.Start != nil {
+			db = db.Where("collection_pos.created_at >= ?", *f.Start)
+		}
+		if f.End != nil {
+			db = db.Where("collection_pos.created_at <= ?", *f.End)
+		}
+		return db.Scopes(tagScope(f.Tags))
+	}
+}
+
+// Stream walks the rows in (origin ASC, created_at DESC, id DESC) order using
+// keyset batches, so each query is cheap and memory stays bounded.
+func (repo *sqlRepo) Stream(ctx context.Context, filter biz.CollectionFilter, fn func(*biz.Collection) error) error {
+	var last *CollectionPO
+	for {
+		var pos []*CollectionPO
+		query := repo.db.WithContext(ctx).Scopes(withTags, filterScope(filter))
+		if last != nil {
+			query = query.Where("(collection_pos.origin > ? OR (collection_pos.origin = ? AND "+
+				"(collection_pos.created_at < ? OR (collection_pos.created_at = ? AND collection_pos.id < ?))))",
+				last.Origin, last.Origin, last.CreatedAt, last.CreatedAt, last.ID)
+		}
+		err := query.
+			Order("collection_pos.origin ASC, collection_pos.created_at DESC, collection_pos.id DESC").
+			Limit(streamBatchSize).
+			Find(&pos).Error
+		if err != nil {
+			return biz.ErrInternalError.WithMessage(err.Error())
+		}
+		for _, po := range pos {
+			if err := fn(po.toBiz()); err != nil {
+				return err
+			}
+		}
+		if len(pos) < streamBatchSize {
+			return nil
+		}
+		last = pos[len(pos)-1]
+	}
+}
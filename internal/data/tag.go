@@ -0,0 +1,109 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/biz"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TagPO is a tag name shared by many collections through collection_tags.
+type TagPO struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"size:64;uniqueIndex"`
+	CreatedAt time.Time
+}
+
+// tagScope restricts a CollectionPO query to rows matching f. OR semantics
+// need any matching tag; AND semantics need as many distinct matches as tags.
+func tagScope(f biz.TagFilter) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if f.Empty() {
+			return db
+		}
+		sub := db.Session(&gorm.Session{NewDB: true}).
+			Table("collection_tags").
+			Select("collection_tags.collection_id").
+			Joins("JOIN tag_pos ON tag_pos.id = collection_tags.tag_id").
+			Where("tag_pos.name IN ?", f.Tags)
+		if f.MatchAll {
+			sub = sub.Group("collection_tags.collection_id").
+				Having("COUNT(DISTINCT tag_pos.name) = ?", len(f.Tags))
+		}
+		return db.Where("collection_pos.id IN (?)", sub)
+	}
+}
+
+func (repo *sqlRepo) AddTags(ctx context.Context, id string, tags []string) error {
+	return repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var po CollectionPO
+		if err := tx.Where("id = ?", id).First(&po).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return biz.ErrNotFound.WithMessage("collection " + id)
+			}
+			return biz.ErrInternalError.WithMessage(err.Error())
+		}
+
+		if err := attachTags(tx, &po, tags); err != nil {
+			return biz.ErrInternalError.WithMessage(err.Error())
+		}
+		return nil
+	})
+}
+
+// attachTags creates the tags that don't exist yet and links them all to po.
+func attachTags(tx *gorm.DB, po *CollectionPO, tags []string) error {
+	tagPOs := make([]TagPO, 0, len(tags))
+	for _, name := range tags {
+		tagPOs = append(tagPOs, TagPO{Name: name, CreatedAt: time.Now()})
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tagPOs).Error; err != nil {
+		return err
+	}
+	// ON CONFLICT DO NOTHING leaves IDs of existing tags unset, so reload them
+	if err := tx.Where("name IN ?", tags).Find(&tagPOs).Error; err != nil {
+		return err
+	}
+	return tx.Model(po).Association("Tags").Append(&tagPOs)
+}
+
+func (repo *sqlRepo) RemoveTag(ctx context.Context, id string, tag string) error {
+	return repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var po CollectionPO
+		if err := tx.Where("id = ?", id).First(&po).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return biz.ErrNotFound.WithMessage("collection " + id)
+			}
+			return biz.ErrInternalError.WithMessage(err.Error())
+		}
+		res := tx.Exec("DELETE FROM collection_tags WHERE collection_id = ? AND tag_id IN (SELECT id FROM tag_pos WHERE name = ?)", id, tag)
+		if res.Error != nil {
+			return biz.ErrInternalError.WithMessage(res.Error.Error())
+		}
+		if res.RowsAffected == 0 {
+			return biz.ErrNotFound.WithMessage("tag " + tag + " on collection " + id)
+		}
+		return nil
+	})
+}
+
+// ListTags counts only collections that are not in the trash.
+func (repo *sqlRepo) ListTags(ctx context.Context) ([]*biz.TagCount, error) {
+	var rows []*biz.TagCount
+	err := repo.db.WithContext(ctx).
+		Table("tag_pos").
+		Select("tag_pos.name AS name, COUNT(collection_pos.id) AS count").
+		Joins("LEFT JOIN collection_tags ON collection_tags.tag_id = tag_pos.id").
+		Joins("LEFT JOIN collection_pos ON collection_pos.id = collection_tags.collection_id AND collection_pos.deleted_at IS NULL").
+		Group("tag_pos.id").
+		Order("count DESC, tag_pos.name").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, biz.ErrInternalError.WithMessage(err.Error())
+	}
+	return rows, nil
+}
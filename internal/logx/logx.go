@@ -8,8 +8,11 @@ import (
 	"time"
 )
 
-// context key type to avoid collisions
-type ctxKey struct{}
+// context key types to avoid collisions
+type (
+	ctxKey       struct{}
+	requestIDKey struct{}
+)
 
 var (
 	once       sync.Once
@@ -66,6 +69,18 @@ func With(ctx context.Context, args ...any) context.Context {
 	return context.WithValue(ctx, ctxKey{}, l)
 }
 
+// WithRequestID stores the request ID so layers below the HTTP handlers can
+// record it, not just log it.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(With(ctx, "request_id", id), requestIDKey{}, id)
+}
+
+// RequestID returns the ID set by WithRequestID, or "" outside a request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
 // base returns the initialized base logger (initializing if necessary).
 func base() *slog.Logger {
 	if baseLogger == nil {
@@ -10,13 +10,39 @@ import (
 	"github.com/google/uuid"
 )
 
-func NewHTTPServer(addr string, cs *service.CollectionService) *http.Server {
+func NewHTTPServer(addr string, cs *service.CollectionService, originSvc *service.OriginService) *http.Server {
 	// ensure logger initialized
 	logx.Init()
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/create", cs.CreateCollection)
+	mux.HandleFunc("POST /extract", cs.Extract)
 	mux.HandleFunc("/getbyorigin", cs.GetByOrigin)
+	mux.HandleFunc("GET /collections", cs.GetByTimeRange)
+	mux.HandleFunc("GET /collections/{id}", cs.GetCollection)
+	mux.HandleFunc("PATCH /collections/{id}", cs.PatchCollection)
+	mux.HandleFunc("DELETE /collections/{id}", cs.DeleteCollection)
+	mux.HandleFunc("GET /collections/{id}/history", cs.CollectionHistory)
+	mux.HandleFunc("POST /collections/{id}/restore", cs.RestoreCollection)
+	mux.HandleFunc("GET /trash", cs.ListTrash)
+	mux.HandleFunc("POST /collections/{id}/tags", cs.AddTags)
+	mux.HandleFunc("DELETE /collections/{id}/tags/{tag}", cs.RemoveTag)
+	mux.HandleFunc("GET /tags", cs.ListTags)
+	mux.HandleFunc("POST /collections/{id}/status", cs.UpdateStatus)
+	mux.HandleFunc("GET /queue", cs.GetQueue)
+	mux.HandleFunc("GET /search", cs.Search)
+	mux.HandleFunc("POST /import/bookmarks", cs.ImportBookmarks)
+	mux.HandleFunc("GET /export", cs.Export)
+	mux.HandleFunc("GET /feeds.atom", cs.AllFeed)
+	mux.HandleFunc("GET /feeds/{file}", cs.OriginFeed)
+	mux.HandleFunc("GET /feeds/tags/{file}", cs.TagFeed)
+	mux.HandleFunc("GET /admin/derived-hosts", cs.DerivedHosts)
+	mux.HandleFunc("POST /admin/reclassify", cs.Reclassify)
+	mux.HandleFunc("GET /origins", originSvc.ListOrigins)
+	mux.HandleFunc("POST /origins", originSvc.CreateOrigin)
+	mux.HandleFunc("GET /origins/{id}", originSvc.GetOrigin)
+	mux.HandleFunc("PUT /origins/{id}", originSvc.UpdateOrigin)
+	mux.HandleFunc("DELETE /origins/{id}", originSvc.DeleteOrigin)
 
 	var handler http.Handler = mux
 	handler = corsMiddleware(handler)
@@ -62,8 +88,7 @@ func requestLoggerMiddleware(next http.Handler) http.Handler {
 			reqID = uuid.NewString()
 		}
 		w.Header().Set("X-Request-ID", reqID)
-		ctx := logx.With(r.Context(),
-			"request_id", reqID,
+		ctx := logx.With(logx.WithRequestID(r.Context(), reqID),
 			"http.method", r.Method,
 			"http.path", r.URL.Path,
 			"remote_addr", r.RemoteAddr,
@@ -107,9 +132,9 @@ func corsMiddleware(next http.Handler) http.Handler {
 		if r.Method == http.MethodOptions {
 
 			// 设置允许的 HTTP 方法
-			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
 
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Client, X-Request-ID")
 
 			w.Header().Set("Access-Control-Max-Age", "3600")
 
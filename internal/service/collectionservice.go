@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github/heimaolst/collectionbox/internal/biz"
@@ -18,11 +20,6 @@ type CollectionService struct {
 type CreateRequest struct {
 	URL string `json:"url"`
 }
-type GetByTimeRangeRequest struct {
-	Origin string     `json:"origin"`
-	Start  *time.Time `json:"start,omitempty"`
-	End    *time.Time `json:"end,omitempty"`
-}
 
 func NewService(uc *biz.CollectionUsecase) *CollectionService {
 	return &CollectionService{
@@ -49,23 +46,129 @@ func (s *CollectionService) CreateCollection(w http.ResponseWriter, r *http.Requ
 	// 2. 调用 Biz 层 (现在的逻辑是：有则更新，无则创建)
 	// 方法名建议改为 UpsertCollectionsFromText 或保持原样但修改内部逻辑
 	ctx := r.Context()
-	cols, err := s.uc.UpsertCollectionsFromText(ctx, req.URL)
+	results, report, err := s.uc.UpsertCollectionsFromText(ctx, req.URL, saveSource(r))
 
-	// 3. 错误处理
+	// 3. 错误处理（如解析不出 URL 时返回 400，并带上每个候选链接的处理结果）
 	if err != nil {
-		// 如果有参数错误（如解析不出 URL）
-		if errors.Is(err, biz.ErrInvalidArgument) {
-			writeError(w, http.StatusBadRequest, err.Error())
-		} else {
-			logx.FromContext(ctx).Error("upsert collections failed", "err", err)
-			writeError(w, http.StatusInternalServerError, "Internal server error")
+		if report != nil && errors.Is(err, biz.ErrInvalidArgument) {
+			writeJSON(w, http.StatusBadRequest, ExtractErrorResponse{Error: err.Error(), Report: toExtractItems(report)})
+			return
 		}
+		writeBizError(w, r, err, "upsert collections failed")
 		return
 	}
 
 	// 4. 返回结果
 	// Upsert 语义下，通常返回 200 OK，因为它不全是新建
-	writeJSON(w, http.StatusOK, cols)
+	resp := CreateResponse{Items: make([]CreateResult, 0, len(results)), Report: toExtractItems(report)}
+	for _, res := range results {
+		resp.Items = append(resp.Items, CreateResult{Collection: res.Collection, Created: res.Created})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// CreateResponse is the body of POST /create.
+type CreateResponse struct {
+	Items  []CreateResult `json:"items"`
+	Report []ExtractItem  `json:"report"`
+}
+
+// CreateResult is one saved link: the collection's fields plus whether this
+// save created it.
+type CreateResult struct {
+	*biz.Collection
+	Created bool `json:"created"`
+}
+
+// ExtractItem reports on one candidate link found in the submitted text.
+// The last four fields describe what would be saved and are only set for
+// accepted candidates.
+type ExtractItem struct {
+	Text        string `json:"text"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason,omitempty"`
+	Detail      string `json:"detail,omitempty"`
+	Key         string `json:"key,omitempty"`
+	Origin      string `json:"origin,omitempty"`
+	Unmapped    bool   `json:"unmapped,omitempty"`
+	RawURL      string `json:"raw_url,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	ContentID   string `json:"content_id,omitempty"`
+	Title       string `json:"title,omitempty"`
+}
+
+func toExtractItems(report *biz.ExtractReport) []ExtractItem {
+	items := make([]ExtractItem, 0, len(report.Candidates))
+	for _, c := range report.Candidates {
+		item := ExtractItem{
+			Text:     c.Text,
+			Status:   string(c.Status),
+			Reason:   string(c.Reason),
+			Detail:   c.Detail,
+			Key:      c.Key,
+			Origin:   c.Origin,
+			Unmapped: c.Unmapped,
+		}
+		if c.Pair != nil {
+			item.RawURL, item.ContentType, item.ContentID, item.Title = c.Pair.URL, c.Pair.ContentType, c.Pair.ContentID, c.Pair.Title
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// DerivedHost is an origin that is not configured, usually one derived from
+// its host, with the number of live collections filed under it.
+type DerivedHost struct {
+	Host  string `json:"host"`
+	Count int64  `json:"count"`
+}
+
+// DerivedHosts handles GET /admin/derived-hosts, listing the hosts worth
+// promoting into configured origins (POST /origins).
+func (s *CollectionService) DerivedHosts(w http.ResponseWriter, r *http.Request) {
+	origins, err := s.uc.DerivedOrigins(r.Context())
+	if err != nil {
+		writeBizError(w, r, err, "list derived hosts failed")
+		return
+	}
+	hosts := make([]DerivedHost, 0, len(origins))
+	for _, o := range origins {
+		hosts = append(hosts, DerivedHost{Host: o.Origin, Count: o.Count})
+	}
+	writeJSON(w, http.StatusOK, hosts)
+}
+
+// ExtractErrorResponse is returned with 400 when no candidate link could be
+// saved, so the caller can see why each was rejected.
+type ExtractErrorResponse struct {
+	Error  string        `json:"error"`
+	Report []ExtractItem `json:"report"`
+}
+
+// ExtractResponse is the body of POST /extract.
+type ExtractResponse struct {
+	Report []ExtractItem `json:"report"`
+}
+
+// Extract handles POST /extract, a dry run of /create: it takes the same body
+// and reports what would be saved without saving anything.
+func (s *CollectionService) Extract(w http.ResponseWriter, r *http.Request) {
+	var req CreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON format: "+err.Error())
+		return
+	}
+	if req.URL == "" {
+		writeError(w, http.StatusBadRequest, "url is required")
+		return
+	}
+	report, err := s.uc.ExtractFromText(r.Context(), req.URL)
+	if err != nil {
+		writeBizError(w, r, err, "extract links failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, ExtractResponse{Report: toExtractItems(report)})
 }
 
 type UpdateCollectionTimeRequest struct {
@@ -85,31 +188,59 @@ func (s *CollectionService) UpdateCollectionTime(w http.ResponseWriter, r *http.
 	writeJSON(w, http.StatusOK, nil)
 }
 
+// PageResponse is the envelope for paginated lists. Pass NextCursor back as
+// ?cursor= to fetch the following page; it is omitted on the last page.
+type PageResponse struct {
+	Items      []*biz.Collection `json:"items"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// GroupedResponse maps each origin to its first page.
+type GroupedResponse struct {
+	Groups map[string]PageResponse `json:"groups"`
+}
+
+func toPageResponse(p *biz.Page) PageResponse {
+	return PageResponse{Items: p.Items, NextCursor: p.NextCursor}
+}
+
+// GetByOrigin handles /getbyorigin?origin=&cursor=&limit=. Without origin it
+// returns the newest per_origin collections of every origin; each group's
+// next_cursor continues that origin.
 func (s *CollectionService) GetByOrigin(w http.ResponseWriter, r *http.Request) {
 	targetOrigin := r.FormValue("origin")
-	var (
-		res interface{}
-		err error
-	)
+	tags, err := parseTagFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	res := GroupedResponse{Groups: make(map[string]PageResponse)}
 	if targetOrigin != "" {
-		cols, err := s.uc.GetByOrigin(r.Context(), targetOrigin)
+		page, err := parsePageRequest(r)
 		if err != nil {
-			logx.FromContext(r.Context()).Error("get by origin failed", "err", err)
-			writeError(w, http.StatusInternalServerError, "Internal server error")
+			writeError(w, http.StatusBadRequest, err.Error())
 			return
 		}
-		mp := make(map[string][]*biz.Collection)
-		for _, col := range cols {
-			mp[col.Origin] = append(mp[col.Origin], col)
+		p, err := s.uc.GetByOrigin(r.Context(), targetOrigin, tags, page)
+		if err != nil {
+			writeBizError(w, r, err, "get by origin failed")
+			return
 		}
-		res = mp
+		res.Groups[targetOrigin] = toPageResponse(p)
 	} else {
-		res, err = s.uc.GetAllGroupedByOrigin(r.Context())
-	}
-	if err != nil {
-		logx.FromContext(r.Context()).Error("get by time range failed", "err", err)
-		writeError(w, http.StatusInternalServerError, "Internal server error")
-		return
+		perOrigin, err := parseIntParam(r, "per_origin")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		groups, err := s.uc.GetAllGroupedByOrigin(r.Context(), tags, perOrigin)
+		if err != nil {
+			writeBizError(w, r, err, "get all grouped by origin failed")
+			return
+		}
+		for origin, p := range groups {
+			res.Groups[origin] = toPageResponse(p)
+		}
 	}
 	writeJSON(w, http.StatusOK, res)
 }
@@ -117,35 +248,385 @@ func (s *CollectionService) GetByOrigin(w http.ResponseWriter, r *http.Request)
 func (s *CollectionService) GetAll(w http.ResponseWriter, r *http.Request) {
 }
 
+// GetByTimeRange handles GET /collections?start=&end=&origin=&tags=&tag_mode=&cursor=&limit=.
+// start and end are RFC3339 timestamps. A missing end defaults to now and a
+// missing start defaults to 24 hours before end.
 func (s *CollectionService) GetByTimeRange(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	end := time.Now()
+	if v := q.Get("end"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "end must be an RFC3339 timestamp")
+			return
+		}
+		end = t
+	}
+	start := end.Add(-24 * time.Hour)
+	if v := q.Get("start"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "start must be an RFC3339 timestamp")
+			return
+		}
+		start = t
+	}
+
+	tags, err := parseTagFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := parsePageRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// if origin == "" it will return all origin (handled by biz layer)
+	p, err := s.uc.GetByTimeRange(r.Context(), start, end, q.Get("origin"), tags, page)
+	if err != nil {
+		writeBizError(w, r, err, "get by time range failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, toPageResponse(p))
+}
+
+// GetCollection handles GET /collections/{id}.
+func (s *CollectionService) GetCollection(w http.ResponseWriter, r *http.Request) {
+	col, err := s.uc.GetByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeBizError(w, r, err, "get collection failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, col)
+}
+
+// maxClientLen bounds the client name stored with each save.
+const maxClientLen = 200
+
+// saveSource attributes a save to the caller: an explicit X-Client header
+// (e.g. "ios-shortcut") wins over the User-Agent.
+func saveSource(r *http.Request) biz.SaveSource {
+	client := strings.TrimSpace(r.Header.Get("X-Client"))
+	if client == "" {
+		client = r.UserAgent()
+	}
+	if len(client) > maxClientLen {
+		client = strings.ToValidUTF8(client[:maxClientLen], "")
+	}
+	return biz.SaveSource{Client: client, RequestID: logx.RequestID(r.Context())}
+}
+
+// HistoryResponse is the body of GET /collections/{id}/history.
+type HistoryResponse struct {
+	Collection *biz.Collection        `json:"collection"`
+	Events     []*biz.CollectionEvent `json:"events"`
+}
+
+// CollectionHistory handles GET /collections/{id}/history, listing every
+// save of the collection newest first.
+func (s *CollectionService) CollectionHistory(w http.ResponseWriter, r *http.Request) {
+	col, err := s.uc.GetByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeBizError(w, r, err, "get collection failed")
+		return
+	}
+	events, err := s.uc.History(r.Context(), col.ID)
+	if err != nil {
+		writeBizError(w, r, err, "get collection history failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, HistoryResponse{Collection: col, Events: events})
+}
+
+// PatchCollectionRequest carries the fields PATCH /collections/{id} may change;
+// omitted fields are left as they are.
+type PatchCollectionRequest struct {
+	Title  *string `json:"title,omitempty"`
+	Origin *string `json:"origin,omitempty"`
+	Note   *string `json:"note,omitempty"`
+}
+
+// PatchCollection handles PATCH /collections/{id}.
+func (s *CollectionService) PatchCollection(w http.ResponseWriter, r *http.Request) {
 	if r.Body != nil {
 		defer r.Body.Close()
 	}
-	var req GetByTimeRangeRequest
+	var req PatchCollectionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, "Invalid JSON format: "+err.Error())
 		return
 	}
-	// clean data
-	// Set default time range to the last 24 hours if not provided
-	// 没有参数视为一天
-	if req.Start == nil {
-		t := time.Now().Add(-24 * time.Hour)
-		req.Start = &t
+	col, err := s.uc.PatchCollection(r.Context(), r.PathValue("id"), biz.CollectionPatch{
+		Title:  req.Title,
+		Origin: req.Origin,
+		Note:   req.Note,
+	})
+	if err != nil {
+		writeBizError(w, r, err, "patch collection failed")
+		return
 	}
-	if req.End == nil {
-		t := time.Now()
-		req.End = &t
-		// if req.Origin == "" it will return all origin (handled by biz layer)
-		cols, err := s.uc.GetByTimeRange(r.Context(), *req.Start, *req.End, req.Origin)
-		if err != nil {
-			logx.FromContext(r.Context()).Error("get by time range failed", "err", err)
-			writeError(w, http.StatusInternalServerError, "Internal server error")
+	writeJSON(w, http.StatusOK, col)
+}
+
+// DeleteCollection handles DELETE /collections/{id}.
+func (s *CollectionService) DeleteCollection(w http.ResponseWriter, r *http.Request) {
+	if err := s.uc.DeleteCollection(r.Context(), r.PathValue("id")); err != nil {
+		writeBizError(w, r, err, "delete collection failed")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListTrash handles GET /trash.
+func (s *CollectionService) ListTrash(w http.ResponseWriter, r *http.Request) {
+	cols, err := s.uc.ListTrash(r.Context())
+	if err != nil {
+		writeBizError(w, r, err, "list trash failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, cols)
+}
+
+// RestoreCollection handles POST /collections/{id}/restore.
+func (s *CollectionService) RestoreCollection(w http.ResponseWriter, r *http.Request) {
+	col, err := s.uc.RestoreCollection(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeBizError(w, r, err, "restore collection failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, col)
+}
+
+type UpdateStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// UpdateStatus handles POST /collections/{id}/status.
+func (s *CollectionService) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Body != nil {
+		defer r.Body.Close()
+	}
+	var req UpdateStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON format: "+err.Error())
+		return
+	}
+	col, err := s.uc.UpdateStatus(r.Context(), r.PathValue("id"), biz.Status(strings.ToLower(req.Status)))
+	if err != nil {
+		writeBizError(w, r, err, "update status failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, col)
+}
+
+// GetQueue handles GET /queue?origin=&cursor=&limit=.
+func (s *CollectionService) GetQueue(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePageRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p, err := s.uc.GetQueue(r.Context(), r.URL.Query().Get("origin"), page)
+	if err != nil {
+		writeBizError(w, r, err, "get queue failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, toPageResponse(p))
+}
+
+// SearchResponse wraps search hits; each hit is a collection plus Snippet
+// (HTML-escaped, with matches wrapped in <mark>) and Rank (lower is better).
+type SearchResponse struct {
+	Items []*biz.SearchResult `json:"items"`
+}
+
+// Search handles GET /search?q=&limit=. q supports "quoted phrases" and
+// origin:/tag: filters, e.g. q=gorm "软删除" origin:zhihu tag:go.
+func (s *CollectionService) Search(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseIntParam(r, "limit")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	results, err := s.uc.Search(r.Context(), r.URL.Query().Get("q"), limit)
+	if err != nil {
+		writeBizError(w, r, err, "search failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, SearchResponse{Items: results})
+}
+
+// maxImportBytes bounds uploaded bookmark files.
+const maxImportBytes = 32 << 20
+
+// ImportResponse reports the outcome of POST /import/bookmarks.
+type ImportResponse struct {
+	Imported    int              `json:"imported"`
+	Duplicates  int              `json:"duplicates"`
+	Trashed     int              `json:"trashed"`
+	Unsupported int              `json:"unsupported"`
+	Failed      int              `json:"failed"`
+	Items       []biz.ImportItem `json:"items"`
+}
+
+// ImportBookmarks handles POST /import/bookmarks, a multipart upload with the
+// browser's bookmarks.html in the "file" field.
+func (s *CollectionService) ImportBookmarks(w http.ResponseWriter, r *http.Request) {
+	// a large export takes longer than the server-wide timeouts allow
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(time.Minute))
+	_ = rc.SetWriteDeadline(time.Now().Add(10 * time.Minute))
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "multipart field \"file\" is required: "+err.Error())
+		return
+	}
+	defer file.Close()
+
+	bookmarks, err := parseNetscapeBookmarks(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid bookmarks file: "+err.Error())
+		return
+	}
+	if len(bookmarks) == 0 {
+		writeError(w, http.StatusBadRequest, "no bookmarks found in file")
+		return
+	}
+
+	report, err := s.uc.ImportBookmarks(r.Context(), bookmarks, saveSource(r))
+	if err != nil {
+		writeBizError(w, r, err, "import bookmarks failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, ImportResponse{
+		Imported:    report.Imported,
+		Duplicates:  report.Duplicates,
+		Trashed:     report.Trashed,
+		Unsupported: report.Unsupported,
+		Failed:      report.Failed,
+		Items:       report.Items,
+	})
+}
+
+// Export handles GET /export?format=json|csv|html|md&origin=&start=&end=&tags=&tag_mode=.
+// The file is streamed; an error after output has started can only truncate it.
+func (s *CollectionService) Export(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name := q.Get("format")
+	if name == "" {
+		name = "json"
+	}
+	format, ok := exportFormats[name]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "format must be one of json, csv, html, md")
+		return
+	}
+
+	filter := biz.CollectionFilter{Origin: q.Get("origin")}
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"start", &filter.Start}, {"end", &filter.End}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, p.name+" must be an RFC3339 timestamp")
+				return
+			}
+			*p.dst = &t
+		}
+	}
+	var err error
+	if filter.Tags, err = parseTagFilter(r); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// a full export can outlive the server-wide write timeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(10 * time.Minute))
+
+	hw := &headerWriter{w: w, format: format}
+	err = writeExport(hw, func(fn func(*biz.Collection) error) error {
+		return s.uc.Export(r.Context(), filter, fn)
+	})
+	if err != nil {
+		if !hw.wroteHeader {
+			writeBizError(w, r, err, "export failed")
 			return
 		}
-		writeJSON(w, http.StatusOK, cols)
+		logx.FromContext(r.Context()).Error("export aborted mid-stream", "format", name, "err", err)
+	}
+}
+
+// AllFeed handles GET /feeds.atom, the newest collections of every origin.
+func (s *CollectionService) AllFeed(w http.ResponseWriter, r *http.Request) {
+	s.serveFeed(w, r, "CollectionBox", biz.CollectionFilter{})
+}
+
+// OriginFeed handles GET /feeds/{origin}.atom.
+func (s *CollectionService) OriginFeed(w http.ResponseWriter, r *http.Request) {
+	origin, ok := strings.CutSuffix(r.PathValue("file"), ".atom")
+	if !ok || origin == "" {
+		writeError(w, http.StatusNotFound, "feed not found")
+		return
+	}
+	s.serveFeed(w, r, "CollectionBox · "+origin, biz.CollectionFilter{Origin: origin})
+}
+
+// TagFeed handles GET /feeds/tags/{tag}.atom.
+func (s *CollectionService) TagFeed(w http.ResponseWriter, r *http.Request) {
+	tag, ok := strings.CutSuffix(r.PathValue("file"), ".atom")
+	if !ok || tag == "" {
+		writeError(w, http.StatusNotFound, "feed not found")
+		return
+	}
+	s.serveFeed(w, r, "CollectionBox · #"+tag, biz.CollectionFilter{Tags: biz.TagFilter{Tags: []string{tag}}})
+}
+
+type AddTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// AddTags handles POST /collections/{id}/tags.
+func (s *CollectionService) AddTags(w http.ResponseWriter, r *http.Request) {
+	if r.Body != nil {
+		defer r.Body.Close()
+	}
+	var req AddTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON format: "+err.Error())
+		return
+	}
+	col, err := s.uc.AddTags(r.Context(), r.PathValue("id"), req.Tags)
+	if err != nil {
+		writeBizError(w, r, err, "add tags failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, col)
+}
 
+// RemoveTag handles DELETE /collections/{id}/tags/{tag}.
+func (s *CollectionService) RemoveTag(w http.ResponseWriter, r *http.Request) {
+	col, err := s.uc.RemoveTag(r.Context(), r.PathValue("id"), r.PathValue("tag"))
+	if err != nil {
+		writeBizError(w, r, err, "remove tag failed")
+		return
 	}
+	writeJSON(w, http.StatusOK, col)
+}
+
+// ListTags handles GET /tags.
+func (s *CollectionService) ListTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := s.uc.ListTags(r.Context())
+	if err != nil {
+		writeBizError(w, r, err, "list tags failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, tags)
 }
 
 // --- 辅助函数 (可以放在这个文件的末尾，或单独的包里) ---
@@ -154,11 +635,72 @@ func writeError(w http.ResponseWriter, statusCode int, message string) {
 	type ErrorResponse struct {
 		Error string `json:"error"`
 	}
-	w.Header().Set("Content-Type", "application/json; charset=utf-F8")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
 }
 
+// parsePageRequest reads cursor= and limit= from the query string.
+func parsePageRequest(r *http.Request) (biz.PageRequest, error) {
+	limit, err := parseIntParam(r, "limit")
+	if err != nil {
+		return biz.PageRequest{}, err
+	}
+	return biz.PageRequest{Cursor: r.URL.Query().Get("cursor"), Limit: limit}, nil
+}
+
+// parseIntParam returns 0 when the parameter is absent.
+func parseIntParam(r *http.Request, name string) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.New(name + " must be an integer")
+	}
+	return n, nil
+}
+
+// parseTagFilter reads tags=a,b (or repeated tag=a&tag=b) and
+// tag_mode=and|or (default or) from the query string.
+func parseTagFilter(r *http.Request) (biz.TagFilter, error) {
+	q := r.URL.Query()
+	var f biz.TagFilter
+	for _, v := range q["tags"] {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				f.Tags = append(f.Tags, t)
+			}
+		}
+	}
+	f.Tags = append(f.Tags, q["tag"]...)
+	switch strings.ToLower(q.Get("tag_mode")) {
+	case "", "or":
+	case "and":
+		f.MatchAll = true
+	default:
+		return f, errors.New("tag_mode must be and or or")
+	}
+	return f, nil
+}
+
+// writeBizError maps biz errors to HTTP status codes; anything unknown is
+// logged and reported as 500.
+func writeBizError(w http.ResponseWriter, r *http.Request, err error, logMsg string) {
+	switch {
+	case errors.Is(err, biz.ErrInvalidArgument):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, biz.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, biz.ErrConflict):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		logx.FromContext(r.Context()).Error(logMsg, "err", err)
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
 func writeJSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(statusCode)
@@ -0,0 +1,439 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/biz"
+	"github/heimaolst/collectionbox/internal/data"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestService returns a service over a fresh SQLite file together with
+// the repo behind it, so tests can seed rows directly.
+func newTestService(t *testing.T) (*CollectionService, biz.CollectionRepo) {
+	t.Helper()
+	db, err := data.Open("sqlite://"+filepath.Join(t.TempDir(), "col.db"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := data.MigrateUp(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	repo := data.NewSQLRepo(db)
+	return NewService(biz.NewCollectionUsecase(repo, nil)), repo
+}
+
+func seedCollections(t *testing.T, repo biz.CollectionRepo, cols ...*biz.Collection) {
+	t.Helper()
+	for _, c := range cols {
+		if _, err := repo.UpsertCollection(context.Background(), c, biz.CollectionEvent{}); err != nil {
+			t.Fatalf("seed %s: %v", c.ID, err)
+		}
+	}
+}
+
+// serve sends one request through h and decodes a JSON response into out
+// when out is not nil.
+func serve(t *testing.T, h http.Handler, method, target, body string, out any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	if out != nil && rec.Code < 300 {
+		if err := json.NewDecoder(rec.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decode: %v", method, target, err)
+		}
+	}
+	return rec.Code
+}
+
+func ids(cols []*biz.Collection) []string {
+	var out []string
+	for _, c := range cols {
+		out = append(out, c.ID)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func TestGetByTimeRange(t *testing.T) {
+	s, repo := newTestService(t)
+	base := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	seedCollections(t, repo,
+		&biz.Collection{ID: "a", URL: "https://bilibili.com/video/BV1", Origin: "Bilibili", CreatedAt: base},
+		&biz.Collection{ID: "b", URL: "https://zhihu.com/question/1", Origin: "Zhihu", CreatedAt: base.Add(time.Hour)},
+		&biz.Collection{ID: "c", URL: "https://bilibili.com/video/BV2", Origin: "Bilibili", CreatedAt: base.Add(48 * time.Hour)},
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /collections", s.GetByTimeRange)
+
+	at := func(d time.Duration) string { return base.Add(d).Format(time.RFC3339) }
+	cases := []struct {
+		query url.Values
+		want  []string
+	}{
+		{url.Values{"start": {at(-time.Minute)}, "end": {at(2 * time.Hour)}}, []string{"a", "b"}},
+		{url.Values{"start": {at(-time.Minute)}, "end": {at(2 * time.Hour)}, "origin": {"Bilibili"}}, []string{"a"}},
+		// start defaults to 24 hours before end
+		{url.Values{"end": {at(49 * time.Hour)}}, []string{"c"}},
+	}
+	for _, tc := range cases {
+		var got PageResponse
+		if code := serve(t, mux, http.MethodGet, "/collections?"+tc.query.Encode(), "", &got); code != http.StatusOK {
+			t.Errorf("%v: status %d", tc.query, code)
+			continue
+		}
+		if !slices.Equal(ids(got.Items), tc.want) {
+			t.Errorf("%v: got %v, want %v", tc.query, ids(got.Items), tc.want)
+		}
+	}
+
+	for _, q := range []string{"start=yesterday", "end=2024-05-01"} {
+		if code := serve(t, mux, http.MethodGet, "/collections?"+q, "", nil); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", q, code)
+		}
+	}
+}
+
+func TestCollectionByID(t *testing.T) {
+	s, repo := newTestService(t)
+	seedCollections(t, repo, &biz.Collection{ID: "a", URL: "https://bilibili.com/video/BV1", Origin: "Bilibili", Title: "old", CreatedAt: time.Now()})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /collections/{id}", s.GetCollection)
+	mux.HandleFunc("PATCH /collections/{id}", s.PatchCollection)
+	mux.HandleFunc("DELETE /collections/{id}", s.DeleteCollection)
+
+	var col biz.Collection
+	if code := serve(t, mux, http.MethodGet, "/collections/a", "", &col); code != http.StatusOK || col.Title != "old" {
+		t.Fatalf("get: status %d, %+v", code, col)
+	}
+
+	if code := serve(t, mux, http.MethodPatch, "/collections/a", `{"title":"  new  "}`, &col); code != http.StatusOK {
+		t.Fatalf("patch: status %d", code)
+	}
+	if col.Title != "new" || col.Origin != "Bilibili" {
+		t.Errorf("patch: got %+v, want the trimmed title and the origin untouched", col)
+	}
+	if code := serve(t, mux, http.MethodPatch, "/collections/a", `{"origin":" "}`, nil); code != http.StatusBadRequest {
+		t.Errorf("patch with empty origin: status %d, want 400", code)
+	}
+	if code := serve(t, mux, http.MethodPatch, "/collections/a", `{`, nil); code != http.StatusBadRequest {
+		t.Errorf("patch with bad JSON: status %d, want 400", code)
+	}
+
+	if code := serve(t, mux, http.MethodDelete, "/collections/a", "", nil); code != http.StatusNoContent {
+		t.Fatalf("delete: status %d", code)
+	}
+	for _, req := range []struct{ method, body string }{
+		{http.MethodGet, ""},
+		{http.MethodPatch, `{"title":"x"}`},
+		{http.MethodDelete, ""},
+	} {
+		if code := serve(t, mux, req.method, "/collections/a", req.body, nil); code != http.StatusNotFound {
+			t.Errorf("%s after delete: status %d, want 404", req.method, code)
+		}
+	}
+}
+
+func TestTrash(t *testing.T) {
+	s, repo := newTestService(t)
+	now := time.Now().UTC()
+	seedCollections(t, repo,
+		&biz.Collection{ID: "a", URL: "https://bilibili.com/video/BV1", Origin: "Bilibili", CreatedAt: now},
+		&biz.Collection{ID: "b", URL: "https://bilibili.com/video/BV2", Origin: "Bilibili", CreatedAt: now},
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /collections", s.GetByTimeRange)
+	mux.HandleFunc("DELETE /collections/{id}", s.DeleteCollection)
+	mux.HandleFunc("POST /collections/{id}/restore", s.RestoreCollection)
+	mux.HandleFunc("GET /trash", s.ListTrash)
+	mux.HandleFunc("/getbyorigin", s.GetByOrigin)
+
+	listed := func() ([]string, []string, []string) {
+		t.Helper()
+		var live PageResponse
+		var trash []*biz.Collection
+		var grouped GroupedResponse
+		serve(t, mux, http.MethodGet, "/collections", "", &live)
+		serve(t, mux, http.MethodGet, "/trash", "", &trash)
+		serve(t, mux, http.MethodGet, "/getbyorigin", "", &grouped)
+		return ids(live.Items), ids(trash), ids(grouped.Groups["Bilibili"].Items)
+	}
+
+	if code := serve(t, mux, http.MethodDelete, "/collections/a", "", nil); code != http.StatusNoContent {
+		t.Fatalf("delete: status %d", code)
+	}
+	live, trash, grouped := listed()
+	if !slices.Equal(live, []string{"b"}) || !slices.Equal(trash, []string{"a"}) || !slices.Equal(grouped, []string{"b"}) {
+		t.Errorf("after delete: live %v, trash %v, grouped %v", live, trash, grouped)
+	}
+
+	var col biz.Collection
+	if code := serve(t, mux, http.MethodPost, "/collections/a/restore", "", &col); code != http.StatusOK || col.ID != "a" || col.DeletedAt != nil {
+		t.Fatalf("restore: status %d, %+v", code, col)
+	}
+	if code := serve(t, mux, http.MethodPost, "/collections/a/restore", "", nil); code != http.StatusNotFound {
+		t.Errorf("restore of a live collection: status %d, want 404", code)
+	}
+	live, trash, _ = listed()
+	if !slices.Equal(live, []string{"a", "b"}) || len(trash) != 0 {
+		t.Errorf("after restore: live %v, trash %v", live, trash)
+	}
+
+	serve(t, mux, http.MethodDelete, "/collections/a", "", nil)
+	n, err := repo.PurgeTrash(context.Background(), time.Now().Add(time.Minute))
+	if err != nil || n != 1 {
+		t.Fatalf("purge: %d, %v", n, err)
+	}
+	if _, trash, _ = listed(); len(trash) != 0 {
+		t.Errorf("after purge: trash %v", trash)
+	}
+	if code := serve(t, mux, http.MethodPost, "/collections/a/restore", "", nil); code != http.StatusNotFound {
+		t.Errorf("restore after purge: status %d, want 404", code)
+	}
+}
+
+func TestTags(t *testing.T) {
+	s, repo := newTestService(t)
+	now := time.Now().UTC()
+	seedCollections(t, repo,
+		&biz.Collection{ID: "a", URL: "https://bilibili.com/video/BV1", Origin: "Bilibili", CreatedAt: now},
+		&biz.Collection{ID: "b", URL: "https://bilibili.com/video/BV2", Origin: "Bilibili", CreatedAt: now},
+		&biz.Collection{ID: "c", URL: "https://zhihu.com/question/1", Origin: "Zhihu", CreatedAt: now},
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /collections", s.GetByTimeRange)
+	mux.HandleFunc("DELETE /collections/{id}", s.DeleteCollection)
+	mux.HandleFunc("POST /collections/{id}/tags", s.AddTags)
+	mux.HandleFunc("DELETE /collections/{id}/tags/{tag}", s.RemoveTag)
+	mux.HandleFunc("GET /tags", s.ListTags)
+
+	var col biz.Collection
+	if code := serve(t, mux, http.MethodPost, "/collections/a/tags", `{"tags":["Go"," go ","web"]}`, &col); code != http.StatusOK {
+		t.Fatalf("add tags: status %d", code)
+	}
+	if slices.Sort(col.Tags); !slices.Equal(col.Tags, []string{"go", "web"}) {
+		t.Errorf("add tags: got %v, want [go web]", col.Tags)
+	}
+	serve(t, mux, http.MethodPost, "/collections/b/tags", `{"tags":["go"]}`, nil)
+	serve(t, mux, http.MethodPost, "/collections/c/tags", `{"tags":["web"]}`, nil)
+	serve(t, mux, http.MethodDelete, "/collections/c", "", nil)
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"tags=go", []string{"a", "b"}},
+		{"tags=go,web", []string{"a", "b"}},
+		{"tags=go,web&tag_mode=and", []string{"a"}},
+		{"tag=web&tag=go&tag_mode=AND", []string{"a"}},
+		{"tags=web", []string{"a"}},
+		{"tags=rust", nil},
+	} {
+		var got PageResponse
+		serve(t, mux, http.MethodGet, "/collections?"+tc.query, "", &got)
+		if !slices.Equal(ids(got.Items), tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.query, ids(got.Items), tc.want)
+		}
+	}
+	if code := serve(t, mux, http.MethodGet, "/collections?tags=go&tag_mode=xor", "", nil); code != http.StatusBadRequest {
+		t.Errorf("bad tag_mode: status %d, want 400", code)
+	}
+
+	// c is in the trash, so web counts only a
+	var counts []*biz.TagCount
+	serve(t, mux, http.MethodGet, "/tags", "", &counts)
+	got := map[string]int64{}
+	for _, tc := range counts {
+		got[tc.Name] = tc.Count
+	}
+	if len(got) != 2 || got["go"] != 2 || got["web"] != 1 {
+		t.Errorf("list tags: got %v, want go:2 web:1", got)
+	}
+
+	if code := serve(t, mux, http.MethodDelete, "/collections/a/tags/WEB", "", &col); code != http.StatusOK || !slices.Equal(col.Tags, []string{"go"}) {
+		t.Errorf("remove tag: status %d, tags %v", code, col.Tags)
+	}
+	for _, tc := range []struct {
+		method, target, body string
+		want                 int
+	}{
+		{http.MethodDelete, "/collections/a/tags/web", "", http.StatusNotFound},
+		{http.MethodPost, "/collections/missing/tags", `{"tags":["go"]}`, http.StatusNotFound},
+		{http.MethodPost, "/collections/a/tags", `{"tags":[]}`, http.StatusBadRequest},
+		{http.MethodPost, "/collections/a/tags", `{"tags":[" "]}`, http.StatusBadRequest},
+		{http.MethodPost, "/collections/a/tags", `{"tags":["` + strings.Repeat("x", 65) + `"]}`, http.StatusBadRequest},
+	} {
+		if code := serve(t, mux, tc.method, tc.target, tc.body, nil); code != tc.want {
+			t.Errorf("%s %s %s: status %d, want %d", tc.method, tc.target, tc.body, code, tc.want)
+		}
+	}
+}
+
+func TestReadStatus(t *testing.T) {
+	s, repo := newTestService(t)
+	base := time.Now().UTC().Add(-time.Hour)
+	seedCollections(t, repo,
+		&biz.Collection{ID: "a", URL: "https://bilibili.com/video/BV1", Origin: "Bilibili", Status: biz.StatusUnread, CreatedAt: base},
+		&biz.Collection{ID: "b", URL: "https://bilibili.com/video/BV2", Origin: "Bilibili", Status: biz.StatusUnread, CreatedAt: base.Add(time.Minute)},
+		&biz.Collection{ID: "c", URL: "https://zhihu.com/question/1", Origin: "Zhihu", Status: biz.StatusUnread, CreatedAt: base.Add(2 * time.Minute)},
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /collections/{id}/status", s.UpdateStatus)
+	mux.HandleFunc("GET /queue", s.GetQueue)
+
+	queue := func(query string) []string {
+		t.Helper()
+		var page PageResponse
+		serve(t, mux, http.MethodGet, "/queue"+query, "", &page)
+		var out []string
+		for _, c := range page.Items {
+			out = append(out, c.ID)
+		}
+		return out
+	}
+	if got := queue(""); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("queue: got %v, want oldest first", got)
+	}
+	if got := queue("?origin=Bilibili"); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("queue for Bilibili: got %v", got)
+	}
+
+	var col biz.Collection
+	if code := serve(t, mux, http.MethodPost, "/collections/a/status", `{"status":"DONE"}`, &col); code != http.StatusOK {
+		t.Fatalf("mark done: status %d", code)
+	}
+	if col.Status != biz.StatusDone || col.ReadAt == nil {
+		t.Errorf("mark done: status %q, read at %v", col.Status, col.ReadAt)
+	}
+	if got := queue(""); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("queue after done: got %v", got)
+	}
+	if serve(t, mux, http.MethodPost, "/collections/a/status", `{"status":"unread"}`, &col); col.Status != biz.StatusUnread || col.ReadAt != nil {
+		t.Errorf("back to unread: status %q, read at %v", col.Status, col.ReadAt)
+	}
+
+	serve(t, mux, http.MethodPost, "/collections/b/status", `{"status":"archived"}`, nil)
+	for _, tc := range []struct {
+		id, body string
+		want     int
+	}{
+		{"b", `{"status":"done"}`, http.StatusBadRequest},
+		{"b", `{"status":"unread"}`, http.StatusOK},
+		{"c", `{"status":"later"}`, http.StatusBadRequest},
+		{"missing", `{"status":"done"}`, http.StatusNotFound},
+	} {
+		if code := serve(t, mux, http.MethodPost, "/collections/"+tc.id+"/status", tc.body, nil); code != tc.want {
+			t.Errorf("%s %s: status %d, want %d", tc.id, tc.body, code, tc.want)
+		}
+	}
+}
+
+func TestPagination(t *testing.T) {
+	s, repo := newTestService(t)
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	// b and c share a timestamp, so the ID breaks the tie
+	seedCollections(t, repo,
+		&biz.Collection{ID: "a", URL: "https://bilibili.com/video/BV1", Origin: "Bilibili", Status: biz.StatusUnread, CreatedAt: base},
+		&biz.Collection{ID: "b", URL: "https://bilibili.com/video/BV2", Origin: "Bilibili", Status: biz.StatusUnread, CreatedAt: base.Add(time.Minute)},
+		&biz.Collection{ID: "c", URL: "https://bilibili.com/video/BV3", Origin: "Bilibili", Status: biz.StatusUnread, CreatedAt: base.Add(time.Minute)},
+		&biz.Collection{ID: "d", URL: "https://zhihu.com/question/1", Origin: "Zhihu", Status: biz.StatusUnread, CreatedAt: base.Add(2 * time.Minute)},
+		&biz.Collection{ID: "e", URL: "https://bilibili.com/video/BV4", Origin: "Bilibili", Status: biz.StatusUnread, CreatedAt: base.Add(3 * time.Minute)},
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /collections", s.GetByTimeRange)
+	mux.HandleFunc("GET /queue", s.GetQueue)
+	mux.HandleFunc("/getbyorigin", s.GetByOrigin)
+
+	// walk follows next_cursor until the last page and returns the pages' IDs.
+	walk := func(target string) [][]string {
+		t.Helper()
+		var pages [][]string
+		cursor := ""
+		for range 10 {
+			var page PageResponse
+			if code := serve(t, mux, http.MethodGet, target+"&cursor="+url.QueryEscape(cursor), "", &page); code != http.StatusOK {
+				t.Fatalf("%s: status %d", target, code)
+			}
+			var got []string
+			for _, c := range page.Items {
+				got = append(got, c.ID)
+			}
+			pages = append(pages, got)
+			if cursor = page.NextCursor; cursor == "" {
+				return pages
+			}
+		}
+		t.Fatalf("%s: no last page", target)
+		return nil
+	}
+	for _, tc := range []struct {
+		target string
+		want   [][]string
+	}{
+		{"/collections?limit=2", [][]string{{"e", "d"}, {"c", "b"}, {"a"}}},
+		{"/collections?limit=5", [][]string{{"e", "d", "c", "b", "a"}}},
+		{"/queue?limit=2", [][]string{{"a", "b"}, {"c", "d"}, {"e"}}},
+	} {
+		if got := walk(tc.target); !slices.EqualFunc(got, tc.want, slices.Equal) {
+			t.Errorf("%s: pages %v, want %v", tc.target, got, tc.want)
+		}
+	}
+
+	// per_origin caps each group; its next_cursor continues that origin
+	var grouped GroupedResponse
+	serve(t, mux, http.MethodGet, "/getbyorigin?per_origin=2", "", &grouped)
+	bili := grouped.Groups["Bilibili"]
+	if !slices.Equal(ids(bili.Items), []string{"c", "e"}) || bili.NextCursor == "" || len(grouped.Groups["Zhihu"].Items) != 1 {
+		t.Fatalf("grouped: %+v", grouped)
+	}
+	grouped = GroupedResponse{}
+	serve(t, mux, http.MethodGet, "/getbyorigin?origin=Bilibili&cursor="+url.QueryEscape(bili.NextCursor), "", &grouped)
+	if got := ids(grouped.Groups["Bilibili"].Items); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("next Bilibili page: got %v, want [a b]", got)
+	}
+
+	for _, target := range []string{
+		"/collections?cursor=not-a-cursor",
+		"/collections?limit=-1",
+		"/collections?limit=ten",
+		"/queue?cursor=%21",
+		"/getbyorigin?per_origin=-1",
+	} {
+		if code := serve(t, mux, http.MethodGet, target, "", nil); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", target, code)
+		}
+	}
+}
+
+func TestCollectionJSON(t *testing.T) {
+	s, repo := newTestService(t)
+	seedCollections(t, repo, &biz.Collection{ID: "a", URL: "https://bilibili.com/video/BV1", Origin: "Bilibili", CreatedAt: time.Now()})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /collections/{id}", s.GetCollection)
+
+	var got map[string]any
+	if code := serve(t, mux, http.MethodGet, "/collections/a", "", &got); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	var keys []string
+	for k := range got {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	want := []string{"content_id", "content_type", "created_at", "deleted_at", "id", "last_saved_at", "note",
+		"origin", "raw_url", "read_at", "save_count", "status", "tags", "title", "url"}
+	if !slices.Equal(keys, want) {
+		t.Errorf("keys %v, want %v", keys, want)
+	}
+}
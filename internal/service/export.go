@@ -0,0 +1,229 @@
+package service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/biz"
+)
+
+// exportWriter renders a stream of collections in one format. Items arrive
+// grouped by origin (see CollectionRepo.Stream), which the grouped formats
+// rely on to emit one section per origin.
+type exportWriter interface {
+	begin() error
+	item(col *biz.Collection) error
+	end() error
+}
+
+type exportFormat struct {
+	contentType string
+	ext         string
+	newWriter   func(w io.Writer) exportWriter
+}
+
+var exportFormats = map[string]exportFormat{
+	"json": {"application/json; charset=utf-8", "json", func(w io.Writer) exportWriter { return &jsonExport{w: w} }},
+	"csv":  {"text/csv; charset=utf-8", "csv", func(w io.Writer) exportWriter { return &csvExport{w: csv.NewWriter(w)} }},
+	"html": {"text/html; charset=utf-8", "html", func(w io.Writer) exportWriter { return &netscapeExport{w: w} }},
+	"md":   {"text/markdown; charset=utf-8", "md", func(w io.Writer) exportWriter { return &markdownExport{w: w} }},
+}
+
+// jsonExport writes a JSON array, one element per collection.
+type jsonExport struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonExport) begin() error {
+	_, err := io.WriteString(e.w, "[\n")
+	return err
+}
+
+func (e *jsonExport) item(col *biz.Collection) error {
+	b, err := json.Marshal(col)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ",\n"); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.w.Write(b)
+	return err
+}
+
+func (e *jsonExport) end() error {
+	_, err := io.WriteString(e.w, "\n]\n")
+	return err
+}
+
+// csvExport writes one row per collection; tags are joined with ";".
+type csvExport struct {
+	w *csv.Writer
+}
+
+func (e *csvExport) begin() error {
+	return e.w.Write([]string{"id", "created_at", "url", "raw_url", "origin", "title", "note", "tags", "status", "read_at"})
+}
+
+func (e *csvExport) item(col *biz.Collection) error {
+	readAt := ""
+	if col.ReadAt != nil {
+		readAt = col.ReadAt.Format(time.RFC3339)
+	}
+	return e.w.Write([]string{
+		col.ID,
+		col.CreatedAt.Format(time.RFC3339),
+		col.URL,
+		col.RawURL,
+		col.Origin,
+		col.Title,
+		col.Note,
+		strings.Join(col.Tags, ";"),
+		string(col.Status),
+		readAt,
+	})
+}
+
+func (e *csvExport) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// netscapeExport writes the bookmarks.html format browsers import, with one
+// folder per origin. POST /import/bookmarks reads it back.
+type netscapeExport struct {
+	w          io.Writer
+	lastOrigin *string
+}
+
+func (e *netscapeExport) begin() error {
+	_, err := io.WriteString(e.w, `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>CollectionBox</H1>
+<DL><p>
+`)
+	return err
+}
+
+func (e *netscapeExport) item(col *biz.Collection) error {
+	if e.lastOrigin == nil || *e.lastOrigin != col.Origin {
+		if e.lastOrigin != nil {
+			if _, err := io.WriteString(e.w, "    </DL><p>\n"); err != nil {
+				return err
+			}
+		}
+		origin := col.Origin
+		e.lastOrigin = &origin
+		if _, err := fmt.Fprintf(e.w, "    <DT><H3>%s</H3>\n    <DL><p>\n", html.EscapeString(origin)); err != nil {
+			return err
+		}
+	}
+	title := col.Title
+	if title == "" {
+		title = col.URL
+	}
+	tags := ""
+	if len(col.Tags) > 0 {
+		tags = ` TAGS="` + html.EscapeString(strings.Join(col.Tags, ",")) + `"`
+	}
+	_, err := fmt.Fprintf(e.w, "        <DT><A HREF=\"%s\" ADD_DATE=\"%s\"%s>%s</A>\n",
+		html.EscapeString(col.URL), strconv.FormatInt(col.CreatedAt.Unix(), 10), tags, html.EscapeString(title))
+	return err
+}
+
+func (e *netscapeExport) end() error {
+	if e.lastOrigin != nil {
+		if _, err := io.WriteString(e.w, "    </DL><p>\n"); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(e.w, "</DL><p>\n")
+	return err
+}
+
+// markdownExport writes a "## Origin" section per origin, like the home page.
+type markdownExport struct {
+	w          io.Writer
+	lastOrigin *string
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`)
+
+func (e *markdownExport) begin() error {
+	_, err := io.WriteString(e.w, "# CollectionBox\n")
+	return err
+}
+
+func (e *markdownExport) item(col *biz.Collection) error {
+	if e.lastOrigin == nil || *e.lastOrigin != col.Origin {
+		origin := col.Origin
+		e.lastOrigin = &origin
+		if _, err := fmt.Fprintf(e.w, "\n## %s\n\n", origin); err != nil {
+			return err
+		}
+	}
+	title := col.Title
+	if title == "" {
+		title = col.URL
+	}
+	line := fmt.Sprintf("- [%s](<%s>) · %s", markdownEscaper.Replace(title), col.URL, col.CreatedAt.Format("2006-01-02"))
+	for _, t := range col.Tags {
+		line += " `#" + t + "`"
+	}
+	if col.Note != "" {
+		line += "\n  > " + strings.ReplaceAll(col.Note, "\n", "\n  > ")
+	}
+	_, err := io.WriteString(e.w, line+"\n")
+	return err
+}
+
+func (e *markdownExport) end() error { return nil }
+
+// headerWriter defers the response headers until the first byte is written,
+// so errors raised before any output can still get a proper status code.
+type headerWriter struct {
+	w           http.ResponseWriter
+	format      exportFormat
+	wroteHeader bool
+}
+
+func (hw *headerWriter) Write(p []byte) (int, error) {
+	if !hw.wroteHeader {
+		hw.wroteHeader = true
+		h := hw.w.Header()
+		h.Set("Content-Type", hw.format.contentType)
+		h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="collectionbox-%s.%s"`, time.Now().Format("20060102"), hw.format.ext))
+		hw.w.WriteHeader(http.StatusOK)
+	}
+	return hw.w.Write(p)
+}
+
+// writeExport drives the writer of format over the collections produced by
+// stream. Output is buffered, so nothing reaches hw until the first few KB.
+func writeExport(hw *headerWriter, stream func(func(*biz.Collection) error) error) error {
+	bw := bufio.NewWriter(hw)
+	out := hw.format.newWriter(bw)
+	if err := out.begin(); err != nil {
+		return err
+	}
+	if err := stream(out.item); err != nil {
+		return err
+	}
+	if err := out.end(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/biz"
+)
+
+const atomContentType = "application/atom+xml; charset=utf-8"
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Link       atomLink       `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary,omitempty"`
+}
+
+// buildAtomFeed renders cols (newest first) as an Atom document. Entry IDs
+// come from Collection.ID so they survive edits and re-saves; an entry's
+// updated time is its last save. It also returns the newest updated time,
+// which is zero for an empty feed.
+func buildAtomFeed(selfURL, title string, cols []*biz.Collection) ([]byte, time.Time, error) {
+	var updated time.Time
+	feed := atomFeed{
+		ID:     selfURL,
+		Title:  title,
+		Links:  []atomLink{{Href: selfURL, Rel: "self"}},
+		Author: atomAuthor{Name: "CollectionBox"},
+	}
+	for _, c := range cols {
+		if c.CreatedAt.After(updated) {
+			updated = c.CreatedAt
+		}
+		entryTitle := c.Title
+		if entryTitle == "" {
+			entryTitle = c.URL
+		}
+		categories := []atomCategory{{Term: c.Origin}}
+		for _, t := range c.Tags {
+			categories = append(categories, atomCategory{Term: t})
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:         "urn:uuid:" + c.ID,
+			Title:      entryTitle,
+			Updated:    c.CreatedAt.UTC().Format(time.RFC3339),
+			Link:       atomLink{Href: c.URL},
+			Categories: categories,
+			Summary:    c.Note,
+		})
+	}
+	// an empty feed still needs a fixed updated time, or the ETag would churn
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+	if updated.IsZero() {
+		feed.Updated = time.Unix(0, 0).UTC().Format(time.RFC3339)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return nil, time.Time{}, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), updated, nil
+}
+
+// requestURL reconstructs the absolute URL the client asked for, honoring a
+// reverse proxy's X-Forwarded-Proto.
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if p := r.Header.Get("X-Forwarded-Proto"); p != "" {
+		scheme = strings.ToLower(strings.TrimSpace(strings.Split(p, ",")[0]))
+	}
+	return scheme + "://" + r.Host + r.URL.EscapedPath()
+}
+
+// serveFeed writes the feed for filter. The ETag hashes the document, so
+// edits to titles or notes are picked up even though they don't move
+// Last-Modified; http.ServeContent answers If-None-Match and
+// If-Modified-Since with 304.
+func (s *CollectionService) serveFeed(w http.ResponseWriter, r *http.Request, title string, filter biz.CollectionFilter) {
+	cols, err := s.uc.Feed(r.Context(), filter)
+	if err != nil {
+		writeBizError(w, r, err, "build feed failed")
+		return
+	}
+	body, updated, err := buildAtomFeed(requestURL(r), title, cols)
+	if err != nil {
+		writeBizError(w, r, err, "encode feed failed")
+		return
+	}
+	sum := sha256.Sum256(body)
+	w.Header().Set("Content-Type", atomContentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "", updated, bytes.NewReader(body))
+}
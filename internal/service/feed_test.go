@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/biz"
+)
+
+// newFeedServer serves the feed routes over two Bilibili links, one tagged
+// go, and one Zhihu link.
+func newFeedServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	s, repo := newTestService(t)
+	base := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	seedCollections(t, repo,
+		&biz.Collection{ID: "b1", URL: "https://bilibili.com/video/BV1", Origin: "Bilibili", Title: "Go 并发入门", CreatedAt: base},
+		&biz.Collection{ID: "b2", URL: "https://bilibili.com/video/BV2", Origin: "Bilibili", CreatedAt: base.Add(time.Hour)},
+		&biz.Collection{ID: "z1", URL: "https://zhihu.com/question/1", Origin: "Zhihu", Note: "读一下", CreatedAt: base.Add(2 * time.Hour)},
+	)
+	if err := repo.AddTags(context.Background(), "b1", []string{"go"}); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /feeds.atom", s.AllFeed)
+	mux.HandleFunc("GET /feeds/{file}", s.OriginFeed)
+	mux.HandleFunc("GET /feeds/tags/{file}", s.TagFeed)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func getFeed(t *testing.T, url string, header http.Header) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = header
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestFeeds(t *testing.T) {
+	srv := newFeedServer(t)
+	cases := []struct {
+		path    string
+		title   string
+		entries []string
+	}{
+		{"/feeds.atom", "CollectionBox", []string{"urn:uuid:z1", "urn:uuid:b2", "urn:uuid:b1"}},
+		{"/feeds/Bilibili.atom", "CollectionBox · Bilibili", []string{"urn:uuid:b2", "urn:uuid:b1"}},
+		{"/feeds/tags/go.atom", "CollectionBox · #go", []string{"urn:uuid:b1"}},
+	}
+	for _, tc := range cases {
+		resp := getFeed(t, srv.URL+tc.path, nil)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != atomContentType {
+			t.Errorf("%s: status %d, Content-Type %q", tc.path, resp.StatusCode, resp.Header.Get("Content-Type"))
+			continue
+		}
+		var feed atomFeed
+		if err := xml.NewDecoder(resp.Body).Decode(&feed); err != nil {
+			t.Errorf("%s: invalid Atom: %v", tc.path, err)
+			continue
+		}
+		if feed.XMLName.Space != "http://www.w3.org/2005/Atom" || feed.Title != tc.title || feed.ID != srv.URL+tc.path {
+			t.Errorf("%s: feed %s %q id %s", tc.path, feed.XMLName.Space, feed.Title, feed.ID)
+		}
+		var ids []string
+		for _, e := range feed.Entries {
+			ids = append(ids, e.ID)
+			if e.Title == "" || e.Link.Href == "" || e.Updated == "" {
+				t.Errorf("%s: incomplete entry %+v", tc.path, e)
+			}
+		}
+		if !slices.Equal(ids, tc.entries) {
+			t.Errorf("%s: entries %v, want %v", tc.path, ids, tc.entries)
+		}
+	}
+
+	for _, path := range []string{"/feeds/Bilibili.rss", "/feeds/tags/go.json", "/feeds/.atom"} {
+		if resp := getFeed(t, srv.URL+path, nil); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 404", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestFeedConditionalGet(t *testing.T) {
+	srv := newFeedServer(t)
+	resp := getFeed(t, srv.URL+"/feeds.atom", nil)
+	etag, modified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" || modified != "Wed, 01 May 2024 10:00:00 GMT" {
+		t.Fatalf("ETag %q, Last-Modified %q; want an ETag and the newest save", etag, modified)
+	}
+
+	for name, h := range map[string]http.Header{
+		"If-None-Match":     {"If-None-Match": {etag}},
+		"If-Modified-Since": {"If-Modified-Since": {modified}},
+	} {
+		if resp := getFeed(t, srv.URL+"/feeds.atom", h); resp.StatusCode != http.StatusNotModified {
+			t.Errorf("%s: status %d, want 304", name, resp.StatusCode)
+		}
+	}
+	stale := http.Header{"If-None-Match": {`"stale"`}}
+	if resp := getFeed(t, srv.URL+"/feeds.atom", stale); resp.StatusCode != http.StatusOK {
+		t.Errorf("stale ETag: status %d, want 200", resp.StatusCode)
+	}
+}
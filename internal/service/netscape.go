@@ -0,0 +1,123 @@
+package service
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/biz"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// parseNetscapeBookmarks reads the bookmarks.html format every browser
+// exports. The format is loose HTML (<DT> is never closed), so it is read
+// token by token: an <H3> names the folder opened by the next <DL>, and
+// </DL> closes it.
+func parseNetscapeBookmarks(r io.Reader) ([]biz.Bookmark, error) {
+	z := html.NewTokenizer(r)
+	var (
+		bookmarks []biz.Bookmark
+		folders   []string
+		// pendingFolder is the last <H3> title, waiting for its <DL>
+		pendingFolder *string
+		// dlFolder records, per open <DL>, whether it pushed a folder
+		dlFolder []bool
+		current  *biz.Bookmark
+		inH3     bool
+		h3Text   strings.Builder
+		aText    strings.Builder
+	)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return bookmarks, nil
+			}
+			return nil, z.Err()
+
+		case html.StartTagToken:
+			tok := z.Token()
+			switch tok.DataAtom {
+			case atom.H3:
+				inH3 = true
+				h3Text.Reset()
+			case atom.Dl:
+				pushed := pendingFolder != nil
+				if pushed {
+					folders = append(folders, *pendingFolder)
+					pendingFolder = nil
+				}
+				dlFolder = append(dlFolder, pushed)
+			case atom.A:
+				href := attr(tok, "href")
+				if href == "" || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+					continue
+				}
+				current = &biz.Bookmark{
+					URL:     href,
+					AddDate: parseAddDate(attr(tok, "add_date")),
+					Folders: append([]string(nil), folders...),
+				}
+				aText.Reset()
+			}
+
+		case html.EndTagToken:
+			switch z.Token().DataAtom {
+			case atom.H3:
+				inH3 = false
+				name := strings.TrimSpace(h3Text.String())
+				pendingFolder = &name
+			case atom.Dl:
+				if n := len(dlFolder); n > 0 {
+					if dlFolder[n-1] && len(folders) > 0 {
+						folders = folders[:len(folders)-1]
+					}
+					dlFolder = dlFolder[:n-1]
+				}
+			case atom.A:
+				if current != nil {
+					current.Title = strings.TrimSpace(aText.String())
+					bookmarks = append(bookmarks, *current)
+					current = nil
+				}
+			}
+
+		case html.TextToken:
+			switch {
+			case inH3:
+				h3Text.Write(z.Text())
+			case current != nil:
+				aText.Write(z.Text())
+			}
+		}
+	}
+}
+
+func attr(tok html.Token, name string) string {
+	for _, a := range tok.Attr {
+		if a.Key == name {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+// parseAddDate accepts Unix seconds, which is what browsers write; some tools
+// emit milliseconds or microseconds, recognized by magnitude.
+func parseAddDate(v string) time.Time {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}
+	}
+	switch {
+	case n > 1e15:
+		return time.UnixMicro(n)
+	case n > 1e12:
+		return time.UnixMilli(n)
+	default:
+		return time.Unix(n, 0)
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/biz"
+)
+
+func TestParseNetscapeBookmarks(t *testing.T) {
+	f, err := os.Open("testdata/bookmarks.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	got, err := parseNetscapeBookmarks(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []struct {
+		url     string
+		title   string
+		folders []string
+		added   int64
+	}{
+		{"https://www.bilibili.com/video/BV1xx411c7mD?spm_id_from=1", "Go 并发入门", []string{"Bookmarks bar", "Go"}, 1600000001},
+		{"https://www.zhihu.com/question/11", "gorm 软删除", []string{"Bookmarks bar", "Go"}, 1600000002},
+		{"https://github.com/golang/go", "golang/go", []string{"Bookmarks bar"}, 1600000003},
+		{"https://m.bilibili.com/video/BV1xx411c7mD", "dup mobile", []string{"Bookmarks bar"}, 1600000004},
+		{"https://item.jd.com/100.html", "键盘", nil, 1600000005},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d bookmarks, got %d: %+v", len(want), len(got), got)
+	}
+	for i, w := range want {
+		b := got[i]
+		if b.URL != w.url || b.Title != w.title || !slices.Equal(b.Folders, w.folders) || !b.AddDate.Equal(time.Unix(w.added, 0)) {
+			t.Errorf("bookmark %d: got %+v, want %+v", i, b, w)
+		}
+	}
+}
+
+func TestNetscapeExportRoundTrip(t *testing.T) {
+	added := time.Unix(1600000001, 0)
+	cols := []*biz.Collection{
+		{URL: "https://bilibili.com/video/BV1xx411c7mD", Origin: "Bilibili", Title: "Go <并发> & 入门", CreatedAt: added},
+		{URL: "https://bilibili.com/video/BV1yy411c7mD?p=2", Origin: "Bilibili", CreatedAt: added},
+		{URL: "https://zhihu.com/question/11", Origin: "Zhihu", Title: "gorm", CreatedAt: added},
+	}
+	var buf bytes.Buffer
+	out := exportFormats["html"].newWriter(&buf)
+	if err := out.begin(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cols {
+		if err := out.item(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.end(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := parseNetscapeBookmarks(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != len(cols) {
+		t.Fatalf("got %d bookmarks, want %d", len(got), len(cols))
+	}
+	for i, c := range cols {
+		wantTitle := c.Title
+		if wantTitle == "" {
+			wantTitle = c.URL
+		}
+		if got[i].URL != c.URL || got[i].Title != wantTitle || !got[i].AddDate.Equal(added) {
+			t.Errorf("bookmark %d = %+v, want %s %q", i, got[i], c.URL, wantTitle)
+		}
+		if !slices.Equal(got[i].Folders, []string{c.Origin}) {
+			t.Errorf("bookmark %d folders = %v, want [%s]", i, got[i].Folders, c.Origin)
+		}
+	}
+}
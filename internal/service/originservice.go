@@ -0,0 +1,159 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github/heimaolst/collectionbox/internal/biz"
+)
+
+type OriginService struct {
+	uc *biz.OriginUsecase
+}
+
+func NewOriginService(uc *biz.OriginUsecase) *OriginService {
+	return &OriginService{uc: uc}
+}
+
+// OriginRequest is the body of POST /origins and PUT /origins/{id}. The rule
+// fields take the same JSON as the keys of an origin.json item.
+type OriginRequest struct {
+	Host       string          `json:"host"`
+	Name       string          `json:"name"`
+	Icon       string          `json:"icon"`
+	Canonical  json.RawMessage `json:"canonical,omitempty"`
+	ContentIDs json.RawMessage `json:"content_ids,omitempty"`
+	ShareText  json.RawMessage `json:"share_text,omitempty"`
+}
+
+type OriginResponse struct {
+	ID         int64           `json:"id"`
+	Host       string          `json:"host"`
+	Name       string          `json:"name"`
+	Icon       string          `json:"icon,omitempty"`
+	Canonical  json.RawMessage `json:"canonical,omitempty"`
+	ContentIDs json.RawMessage `json:"content_ids,omitempty"`
+	ShareText  json.RawMessage `json:"share_text,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+func toOriginResponse(o *biz.Origin) OriginResponse {
+	return OriginResponse{
+		ID:         o.ID,
+		Host:       o.Host,
+		Name:       o.Name,
+		Icon:       o.Icon,
+		Canonical:  o.Canonical,
+		ContentIDs: o.ContentIDs,
+		ShareText:  o.ShareText,
+		CreatedAt:  o.CreatedAt,
+		UpdatedAt:  o.UpdatedAt,
+	}
+}
+
+// ListOrigins handles GET /origins.
+func (s *OriginService) ListOrigins(w http.ResponseWriter, r *http.Request) {
+	origins, err := s.uc.List(r.Context())
+	if err != nil {
+		writeBizError(w, r, err, "list origins failed")
+		return
+	}
+	resp := make([]OriginResponse, 0, len(origins))
+	for _, o := range origins {
+		resp = append(resp, toOriginResponse(o))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// GetOrigin handles GET /origins/{id}.
+func (s *OriginService) GetOrigin(w http.ResponseWriter, r *http.Request) {
+	id, ok := originID(w, r)
+	if !ok {
+		return
+	}
+	o, err := s.uc.Get(r.Context(), id)
+	if err != nil {
+		writeBizError(w, r, err, "get origin failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, toOriginResponse(o))
+}
+
+// CreateOrigin handles POST /origins.
+func (s *OriginService) CreateOrigin(w http.ResponseWriter, r *http.Request) {
+	o, ok := decodeOrigin(w, r)
+	if !ok {
+		return
+	}
+	o, err := s.uc.Create(r.Context(), o)
+	if err != nil {
+		writeBizError(w, r, err, "create origin failed")
+		return
+	}
+	writeJSON(w, http.StatusCreated, toOriginResponse(o))
+}
+
+// UpdateOrigin handles PUT /origins/{id}; fields left out of the body are
+// cleared.
+func (s *OriginService) UpdateOrigin(w http.ResponseWriter, r *http.Request) {
+	id, ok := originID(w, r)
+	if !ok {
+		return
+	}
+	o, ok := decodeOrigin(w, r)
+	if !ok {
+		return
+	}
+	o.ID = id
+	o, err := s.uc.Update(r.Context(), o)
+	if err != nil {
+		writeBizError(w, r, err, "update origin failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, toOriginResponse(o))
+}
+
+// DeleteOrigin handles DELETE /origins/{id}. Collections already filed under
+// the origin keep its name.
+func (s *OriginService) DeleteOrigin(w http.ResponseWriter, r *http.Request) {
+	id, ok := originID(w, r)
+	if !ok {
+		return
+	}
+	if err := s.uc.Delete(r.Context(), id); err != nil {
+		writeBizError(w, r, err, "delete origin failed")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func originID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid origin id")
+		return 0, false
+	}
+	return id, true
+}
+
+func decodeOrigin(w http.ResponseWriter, r *http.Request) (*biz.Origin, bool) {
+	if r.Body != nil {
+		defer r.Body.Close()
+	}
+	var req OriginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON format: "+err.Error())
+		return nil, false
+	}
+	return &biz.Origin{
+		Host:       req.Host,
+		Name:       req.Name,
+		Icon:       req.Icon,
+		Canonical:  req.Canonical,
+		ContentIDs: req.ContentIDs,
+		ShareText:  req.ShareText,
+	}, true
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github/heimaolst/collectionbox/internal/biz"
+)
+
+// maxReclassifyLimit bounds one POST /admin/reclassify call so it finishes
+// well inside the server's write timeout; larger stores take several calls.
+const maxReclassifyLimit = 5000
+
+// ReclassifyRequest is the body of POST /admin/reclassify; every field is
+// optional. Limit defaults to, and is capped at, maxReclassifyLimit.
+type ReclassifyRequest struct {
+	DryRun bool   `json:"dry_run"`
+	After  string `json:"after"`
+	Limit  int    `json:"limit"`
+}
+
+type OriginChange struct {
+	ID   string `json:"id"`
+	URL  string `json:"url"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type OriginMove struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Count int    `json:"count"`
+}
+
+// ReclassifyResponse reports one call. While Next is non-empty there are
+// collections left: send it back as "after" to carry on.
+type ReclassifyResponse struct {
+	DryRun    bool           `json:"dry_run"`
+	Scanned   int            `json:"scanned"`
+	Changed   int            `json:"changed"`
+	Unmatched int            `json:"unmatched"`
+	Skipped   int            `json:"skipped"`
+	Moves     []OriginMove   `json:"moves"`
+	Changes   []OriginChange `json:"changes"`
+	Next      string         `json:"next,omitempty"`
+}
+
+// Reclassify handles POST /admin/reclassify, re-running stored links through
+// the current origin rules.
+func (s *CollectionService) Reclassify(w http.ResponseWriter, r *http.Request) {
+	var req ReclassifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "Invalid JSON format: "+err.Error())
+		return
+	}
+	if req.Limit < 0 {
+		writeError(w, http.StatusBadRequest, "limit must not be negative")
+		return
+	}
+	if req.Limit == 0 || req.Limit > maxReclassifyLimit {
+		req.Limit = maxReclassifyLimit
+	}
+	report, err := s.uc.Reclassify(r.Context(), biz.ReclassifyOptions{DryRun: req.DryRun, After: req.After, Limit: req.Limit})
+	if err != nil {
+		writeBizError(w, r, err, "reclassify failed")
+		return
+	}
+	resp := ReclassifyResponse{
+		DryRun:    report.DryRun,
+		Scanned:   report.Scanned,
+		Changed:   report.Changed,
+		Unmatched: report.Unmatched,
+		Skipped:   report.Skipped,
+		Moves:     make([]OriginMove, 0, len(report.Moves)),
+		Changes:   make([]OriginChange, 0, len(report.Changes)),
+		Next:      report.Next,
+	}
+	for _, m := range report.Moves {
+		resp.Moves = append(resp.Moves, OriginMove{From: m.From, To: m.To, Count: m.Count})
+	}
+	for _, c := range report.Changes {
+		resp.Changes = append(resp.Changes, OriginChange{ID: c.ID, URL: c.URL, From: c.From, To: c.To})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}